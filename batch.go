@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+	"gopkg.in/yaml.v3"
+)
+
+// BatchEntry is one line of a batch file. Start and duration accept seconds or m:ss.
+type BatchEntry struct {
+	URL        string `yaml:"url"`
+	Start      string `yaml:"start"`
+	Duration   string `yaml:"duration"`
+	SongName   string `yaml:"songname"`
+	AuthorName string `yaml:"authorname"`
+	To         string `yaml:"to"`
+	At         string `yaml:"at"`
+
+	// line is where the entry starts in the batch file, for error messages.
+	line int
+}
+
+// batchItem is a validated entry ready to be made.
+type batchItem struct {
+	entry        BatchEntry
+	request      pipeline.ClipRequest
+	destinations []config.Destination
+	publishAt    time.Time
+
+	job     *pipeline.ClipJob
+	status  string
+	summary string
+	output  string
+}
+
+var batchColumns = []string{"url", "start", "duration", "songname", "authorname", "to", "at"}
+
+var batchCmd = &command{
+	name:    "batch",
+	args:    "[flags] <file.csv|file.yaml>",
+	summary: "make and publish every circle listed in a CSV or YAML file",
+	about: "Makes and publishes every circle listed in a CSV or YAML file.\n" +
+		"Columns/keys: " + strings.Join(batchColumns, ", ") + ". Only url, start and duration are required.\n\n" +
+		"If every failed entry failed the same way, the exit code tells which stage it was.",
+	config: true,
+	events: true,
+	setup:  setupBatch,
+}
+
+func setupBatch(fs *flag.FlagSet, common *commonFlags) func(string) {
+	cookiesFlag := fs.String("cookies", "youtube_cookies.txt", "Path to a cookies file")
+	testFlag := fs.Bool("t", false, "Use the test Telegram channel for entries without a destination")
+	var toFlag stringListFlag
+	fs.Var(&toFlag, "to", "Destination names for entries without a destination, or \"all\" (overrides -t)")
+	removeFlag := fs.Bool("r", true, "Remove temporary files after completion (e.g., -r=false to keep)")
+	historyFlag := fs.String("history", defaultHistoryPath, "Path to the local history of posted video notes")
+	forceFlag := fs.Bool("force", false, "Post even if a track was already posted to a destination within duplicate_window")
+	queueFlag := fs.String("queue", defaultQueueDir, "Directory holding scheduled jobs")
+	messageTemplateFlag := fs.String("message-template", "", "text/template for the link message, overriding config.json (prefix with @ to read from a file)")
+	parseModeFlag := fs.String("parse-mode", "", "Telegram parse_mode for the link message: MarkdownV2 or HTML")
+
+	return func(string) {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		path := fs.Arg(0)
+
+		cfg, _, err := common.loadConfig()
+		if err != nil {
+			fatal(exitFailure, "Failed to load config", "err", err)
+		}
+		entries, err := loadBatchFile(path)
+		if err != nil {
+			fatal(exitFailure, "Failed to read batch file", "err", err)
+		}
+		if len(entries) == 0 {
+			fatal(exitFailure, "Batch file has no entries", "file", path)
+		}
+		runTemplate, err := loadTemplateArg(*messageTemplateFlag)
+		if err != nil {
+			fatal(exitFailure, "Failed to load message template", "err", err)
+		}
+
+		var items []*batchItem
+		invalid := 0
+		for _, entry := range entries {
+			item, err := validateBatchEntry(cfg, entry, toFlag, *testFlag, runTemplate, *parseModeFlag)
+			if err != nil {
+				slog.Error("Invalid batch entry", "file", path, "line", entry.line, "err", err)
+				invalid++
+				continue
+			}
+			items = append(items, item)
+		}
+		if invalid > 0 {
+			fatal(exitFailure, "Entries are invalid, nothing was made", "invalid", invalid, "entries", len(entries))
+		}
+
+		pl := pipeline.New(cfg, *cookiesFlag)
+		pool := pipeline.NewWorkerPool(pl, defaultWorkDir, cfg.Workers)
+		watchJobs(pool)
+		for i, item := range items {
+			item.job, err = pool.Submit(fmt.Sprintf("#%d %s", i+1, item.entry.URL), item.request)
+			if err != nil {
+				fatal(exitFailure, "Failed to start job", "err", err)
+			}
+		}
+
+		failed, code := 0, 0
+		fail := func(c int) {
+			failed++
+			if code == 0 {
+				code = c
+			} else if code != c {
+				code = exitFailure
+			}
+		}
+		for _, item := range items {
+			clip, err := item.job.Wait()
+			if err != nil {
+				fail(stageExitCode(err))
+				item.status, item.summary = "❌ failed", err.Error()
+			} else {
+				destFailed, summary := deliverClip(cfg, pl, clip, nil, item.destinations, item.publishAt, *historyFlag, *queueFlag, *forceFlag)
+				item.summary = summary
+				switch {
+				case destFailed == 0:
+					item.status = "✅ ok"
+				case destFailed < len(item.destinations):
+					fail(exitPublish)
+					item.status = "⚠️ partial"
+				default:
+					fail(exitPublish)
+					item.status = "❌ failed"
+				}
+				if !*removeFlag {
+					item.output = clip.Path
+				}
+			}
+			if *removeFlag {
+				if err := os.RemoveAll(item.job.WorkDir); err != nil {
+					item.job.Log.Warn("Failed to remove temporary directory", "path", item.job.WorkDir, "err", err)
+				}
+			}
+		}
+
+		printBatchSummary(os.Stdout, items)
+		if failed > 0 {
+			fatal(code, "Entries failed", "failed", failed, "entries", len(items))
+		}
+	}
+}
+
+// validateBatchEntry checks everything about an entry that can be checked before
+// downloading, so a typo on the last line doesn't surface after an hour of encoding.
+func validateBatchEntry(cfg *config.Config, entry BatchEntry, defaultTo []string, useTestChannel bool, runTemplate, runParseMode string) (*batchItem, error) {
+	if entry.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	if !strings.HasPrefix(entry.URL, "http://") && !strings.HasPrefix(entry.URL, "https://") {
+		return nil, fmt.Errorf("url %q is not an http(s) URL", entry.URL)
+	}
+	if entry.Start == "" || entry.Duration == "" {
+		return nil, errors.New("start and duration are required")
+	}
+	start, err := pipeline.ParseTimestamp(entry.Start)
+	if err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	seconds, err := pipeline.ParseTimestamp(entry.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("duration: %w", err)
+	}
+	duration, clamped, err := pipeline.ClampDuration(seconds)
+	if err != nil {
+		return nil, err
+	}
+	if clamped {
+		fmt.Printf("Warning: line %d: duration %d seconds is greater than %d. Clamping to %d seconds.\n", entry.line, seconds, pipeline.MaxClipDuration, pipeline.MaxClipDuration)
+	}
+	if (entry.SongName == "") != (entry.AuthorName == "") {
+		return nil, errors.New("songname and authorname must be set together")
+	}
+
+	names := defaultTo
+	if entry.To != "" {
+		names = nil
+		for _, name := range strings.Split(entry.To, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	destinations, err := cfg.ResolveDestinations(names, useTestChannel)
+	if err != nil {
+		return nil, err
+	}
+	destinations, err = pipeline.ApplyMessageTemplates(destinations, cfg, runTemplate, runParseMode)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &batchItem{
+		entry:        entry,
+		destinations: destinations,
+		request: pipeline.ClipRequest{
+			URL:        entry.URL,
+			Start:      start,
+			Duration:   duration,
+			SongName:   entry.SongName,
+			AuthorName: entry.AuthorName,
+		},
+	}
+	if entry.At != "" {
+		item.publishAt, err = parseScheduleTime(entry.At, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if !item.publishAt.After(time.Now()) {
+			return nil, fmt.Errorf("schedule time %s is in the past", item.publishAt.Format(time.RFC3339))
+		}
+	}
+	return item, nil
+}
+
+// loadBatchFile reads entries from a .csv file with a header row, or a .yaml/.yml file
+// holding a list of entries.
+func loadBatchFile(path string) ([]BatchEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return parseBatchCSV(file)
+	case ".yaml", ".yml":
+		return parseBatchYAML(file)
+	default:
+		return nil, fmt.Errorf("unsupported batch file %s: use .csv, .yaml or .yml", path)
+	}
+}
+
+func parseBatchCSV(r io.Reader) ([]BatchEntry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(batchColumns, name) {
+			return nil, fmt.Errorf("unknown column %q; known columns are %s", name, strings.Join(batchColumns, ", "))
+		}
+		columns[name] = i
+	}
+
+	var entries []BatchEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		entries = append(entries, BatchEntry{
+			URL:        field("url"),
+			Start:      field("start"),
+			Duration:   field("duration"),
+			SongName:   field("songname"),
+			AuthorName: field("authorname"),
+			To:         field("to"),
+			At:         field("at"),
+			line:       line,
+		})
+	}
+}
+
+func parseBatchYAML(r io.Reader) ([]BatchEntry, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.SequenceNode {
+		return nil, errors.New("expected a list of entries")
+	}
+
+	var entries []BatchEntry
+	for _, node := range doc.Content[0].Content {
+		var entry BatchEntry
+		if err := node.Decode(&entry); err != nil {
+			return nil, err
+		}
+		entry.line = node.Line
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func printBatchSummary(w io.Writer, items []*batchItem) {
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTATUS\tURL\tCLIP\tRESULT\tOUTPUT")
+	for i, item := range items {
+		clip := fmt.Sprintf("%s +%ds", pipeline.FormatDuration(item.request.Start), item.request.Duration)
+		output := item.output
+		if output == "" {
+			output = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, item.status, item.entry.URL, clip, item.summary, output)
+	}
+	tw.Flush()
+}
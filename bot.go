@@ -0,0 +1,705 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+const defaultBotWorkDir = "temp/bot"
+
+const botAllowedUpdates = `["message","callback_query","inline_query"]`
+
+const (
+	stageAwaitingStart = iota + 1
+	stageAwaitingDuration
+)
+
+// botSession is an unfinished conversation with one user, waiting for start or duration.
+type botSession struct {
+	stage int
+	url   string
+	start int
+}
+
+// botPreview is a circle sent privately to its author and waiting for approval.
+type botPreview struct {
+	id        string
+	chatID    int64
+	messageID int
+	clip      *pipeline.Clip
+	data      pipeline.MessageData
+	// busy is set while the preview is re-cut or published; it takes no other action then.
+	busy bool
+	// touched is when the preview was sent or last acted on, for expiring it.
+	touched time.Time
+}
+
+// defaultPreviewTTL is how long a preview waits for its author before it is dropped.
+const defaultPreviewTTL = 24 * time.Hour
+
+type Bot struct {
+	cfg          *config.Config
+	tg           *telegram.Client
+	pipeline     *pipeline.Pipeline
+	destinations []config.Destination
+	historyPath  string
+	queueDir     string
+	pool         *pipeline.WorkerPool
+	previewTTL   time.Duration
+
+	// mu guards the fields below. Updates are handled with it held, so anything slow, such
+	// as an encode or an upload, runs in a spawned goroutine that takes it only to update them.
+	mu sync.Mutex
+	// wg tracks the spawned goroutines.
+	wg sync.WaitGroup
+
+	sessions      map[int64]*botSession
+	previews      map[string]*botPreview
+	reviewPrompts map[int]reviewPrompt
+	// reviewing holds the queue jobs being published or re-cut, which take no other action.
+	reviewing map[string]bool
+	nextID    int
+}
+
+var botCmd = &command{
+	name:    "bot",
+	args:    "[flags]",
+	summary: "run the Telegram bot that makes circles on request",
+	about:   "Runs a Telegram bot that makes circles for the users listed in bot.allowed_users of config.json.",
+	config:  true,
+	setup:   setupBot,
+}
+
+func setupBot(fs *flag.FlagSet, common *commonFlags) func(string) {
+	cookiesFlag := fs.String("cookies", "youtube_cookies.txt", "Path to a cookies file")
+	historyFlag := fs.String("history", defaultHistoryPath, "Path to the local history of posted video notes")
+	queueFlag := fs.String("queue", defaultQueueDir, "Directory holding scheduled jobs and clips awaiting review")
+	pollTimeoutFlag := fs.Int("poll-timeout", 30, "Long polling timeout in seconds for getUpdates")
+	webhookFlag := fs.String("webhook", "", "Public https URL to receive updates on instead of long polling (default from bot.webhook_url)")
+	listenFlag := fs.String("listen", "", "Address for the webhook HTTP server (default from bot.webhook_listen, else :8080)")
+	deleteWebhookFlag := fs.Bool("delete-webhook", true, "Remove the webhook from Telegram when the bot stops")
+	previewTTLFlag := fs.Duration("preview-ttl", defaultPreviewTTL, "Drop previews and their files after they have been left alone this long")
+
+	return func(string) {
+		cfg, _, err := common.loadConfig()
+		if err != nil {
+			fatal(exitFailure, "Failed to load config", "err", err)
+		}
+		if *previewTTLFlag <= 0 {
+			fatal(exitUsage, "-preview-ttl must be positive")
+		}
+		bot, err := newBot(cfg, *cookiesFlag, *historyFlag, *queueFlag)
+		if err != nil {
+			fatal(exitFailure, "Failed to start the bot", "err", err)
+		}
+		bot.previewTTL = *previewTTLFlag
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go bot.expirePreviews(ctx)
+
+		fmt.Printf("🤖 Bot started for %d allowed users. Press Ctrl+C to stop.\n", len(cfg.Bot.AllowedUsers))
+
+		webhookURL := *webhookFlag
+		if webhookURL == "" {
+			webhookURL = cfg.Bot.WebhookURL
+		}
+		if webhookURL == "" {
+			bot.poll(ctx, *pollTimeoutFlag)
+			fmt.Println("Bot stopped.")
+			return
+		}
+
+		listenAddr := *listenFlag
+		if listenAddr == "" {
+			listenAddr = cfg.Bot.WebhookListen
+		}
+		if listenAddr == "" {
+			listenAddr = ":8080"
+		}
+		secret := cfg.Bot.WebhookSecret
+		if secret == "" {
+			secret, err = generateWebhookSecret()
+			if err != nil {
+				fatal(exitFailure, "Failed to generate webhook secret", "err", err)
+			}
+		}
+
+		err = bot.serveWebhook(ctx, listenAddr, webhookURL, secret)
+		if *deleteWebhookFlag {
+			if delErr := deleteWebhook(context.Background(), bot.tg); delErr != nil {
+				slog.Warn("Failed to delete webhook", "err", delErr)
+			}
+		}
+		if err != nil {
+			fatal(exitFailure, "Webhook server failed", "err", err)
+		}
+		fmt.Println("Bot stopped.")
+	}
+}
+
+func newBot(cfg *config.Config, cookies, historyPath, queueDir string) (*Bot, error) {
+	if len(cfg.Bot.AllowedUsers) == 0 {
+		return nil, fmt.Errorf("bot.allowed_users is empty in config.json; refusing to serve everyone")
+	}
+	destinations, err := cfg.ResolveDestinations(cfg.Bot.PublishTo, false)
+	if err != nil {
+		return nil, err
+	}
+	destinations, err = pipeline.ApplyMessageTemplates(destinations, cfg, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	workDir := cfg.Bot.WorkDir
+	if workDir == "" {
+		workDir = defaultBotWorkDir
+	}
+	pl := pipeline.New(cfg, cookies)
+	return &Bot{
+		cfg:           cfg,
+		tg:            cfg.TelegramClient(),
+		pipeline:      pl,
+		destinations:  destinations,
+		historyPath:   historyPath,
+		queueDir:      queueDir,
+		pool:          pipeline.NewWorkerPool(pl, workDir, cfg.Workers),
+		previewTTL:    defaultPreviewTTL,
+		sessions:      make(map[int64]*botSession),
+		previews:      make(map[string]*botPreview),
+		reviewPrompts: make(map[int]reviewPrompt),
+		reviewing:     make(map[string]bool),
+	}, nil
+}
+
+// poll fetches updates with getUpdates until ctx is cancelled.
+func (b *Bot) poll(ctx context.Context, timeoutSec int) {
+	offset := 0
+	for ctx.Err() == nil {
+		params := url.Values{}
+		params.Add("offset", strconv.Itoa(offset))
+		params.Add("timeout", strconv.Itoa(timeoutSec))
+		params.Add("allowed_updates", botAllowedUpdates)
+
+		var updates []telegram.Update
+		if err := b.tg.Call(ctx, "getUpdates", params, &updates); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("getUpdates failed, retrying in 5 seconds", "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			b.handleUpdate(update)
+		}
+	}
+}
+
+func (b *Bot) handleUpdate(update telegram.Update) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case update.Message != nil:
+		b.handleMessage(update.Message)
+	case update.CallbackQuery != nil:
+		b.handleCallback(update.CallbackQuery)
+	case update.InlineQuery != nil:
+		b.handleInlineQuery(update.InlineQuery)
+	}
+}
+
+// spawn runs work in the background, so that handling an update doesn't hold mu for the
+// length of an encode or an upload. work must lock mu itself to touch the bot's state.
+func (b *Bot) spawn(work func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		work()
+	}()
+}
+
+func (b *Bot) isAllowed(user *telegram.User) bool {
+	return user != nil && slices.Contains(b.cfg.Bot.AllowedUsers, user.ID)
+}
+
+func (b *Bot) reply(chatID int64, text string, opts telegram.SendOptions) (*telegram.Message, error) {
+	// Replies often quote errors, which can carry the Bot API URL with the token.
+	message, err := b.tg.SendMessage(strconv.FormatInt(chatID, 10), logging.Redact(text), "", true, opts)
+	if err != nil {
+		slog.Warn("Failed to reply", "chat_id", chatID, "err", err)
+	}
+	return message, err
+}
+
+const botHelpText = `Send me a song link (e.g. from song.link) and I'll make a circle out of it.
+
+You can send everything at once: <link> <start> <duration>, e.g.
+https://song.link/i/123 1:20 30
+
+Or send just the link and I'll ask for the start time and duration.
+/cancel aborts the current conversation.
+/jobs shows the circles being made.`
+
+func (b *Bot) handleMessage(msg *telegram.Message) {
+	if b.handleModeratorReply(msg) {
+		return
+	}
+	if msg.Chat.Type != "private" {
+		return
+	}
+	chatID := msg.Chat.ID
+	if !b.isAllowed(msg.From) {
+		userID := int64(0)
+		if msg.From != nil {
+			userID = msg.From.ID
+		}
+		slog.Info("Ignoring message from a user not in bot.allowed_users", "user_id", userID)
+		b.reply(chatID, fmt.Sprintf("Sorry, you are not allowed to use this bot. Your user ID is %d.", userID), telegram.SendOptions{})
+		return
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	switch text {
+	case "", "/start", "/help":
+		b.reply(chatID, botHelpText, telegram.SendOptions{})
+		return
+	case "/start " + inlineFailedStart:
+		b.reply(chatID, inlineFailedText, telegram.SendOptions{})
+		return
+	case "/cancel":
+		delete(b.sessions, chatID)
+		b.reply(chatID, "Cancelled.", telegram.SendOptions{})
+		return
+	case "/jobs":
+		b.replyJobs(chatID)
+		return
+	}
+
+	fields := strings.Fields(text)
+	if strings.HasPrefix(fields[0], "http://") || strings.HasPrefix(fields[0], "https://") {
+		delete(b.sessions, chatID)
+		session := &botSession{url: fields[0]}
+		b.continueSession(chatID, session, fields[1:])
+		return
+	}
+
+	session, ok := b.sessions[chatID]
+	if !ok {
+		b.reply(chatID, botHelpText, telegram.SendOptions{})
+		return
+	}
+	b.continueSession(chatID, session, fields)
+}
+
+// continueSession feeds the remaining words of a message into the conversation and
+// starts making the circle once both start and duration are known.
+func (b *Bot) continueSession(chatID int64, session *botSession, fields []string) {
+	if session.stage == 0 {
+		session.stage = stageAwaitingStart
+	}
+	for len(fields) > 0 {
+		value := fields[0]
+		fields = fields[1:]
+
+		switch session.stage {
+		case stageAwaitingStart:
+			start, err := pipeline.ParseTimestamp(value)
+			if err != nil {
+				b.sessions[chatID] = session
+				b.reply(chatID, fmt.Sprintf("I couldn't read the start time %q. Send it as seconds or m:ss, e.g. 1:20.", value), telegram.SendOptions{})
+				return
+			}
+			session.start = start
+			session.stage = stageAwaitingDuration
+		case stageAwaitingDuration:
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				b.sessions[chatID] = session
+				b.reply(chatID, fmt.Sprintf("I couldn't read the duration %q. Send it in seconds, from %d to %d.", value, pipeline.MinClipDuration, pipeline.MaxClipDuration), telegram.SendOptions{})
+				return
+			}
+			duration, clamped, err := pipeline.ClampDuration(seconds)
+			if err != nil {
+				b.sessions[chatID] = session
+				b.reply(chatID, fmt.Sprintf("The duration must be from %d to %d seconds.", pipeline.MinClipDuration, pipeline.MaxClipDuration), telegram.SendOptions{})
+				return
+			}
+			if clamped {
+				b.reply(chatID, fmt.Sprintf("Circles are at most %d seconds long, using %d.", pipeline.MaxClipDuration, duration), telegram.SendOptions{})
+			}
+			delete(b.sessions, chatID)
+			b.makePreview(chatID, session.url, session.start, duration)
+			return
+		}
+	}
+
+	b.sessions[chatID] = session
+	if session.stage == stageAwaitingStart {
+		b.reply(chatID, "Where should the circle start? Send seconds or m:ss, e.g. 1:20.", telegram.SendOptions{})
+	} else {
+		b.reply(chatID, fmt.Sprintf("How long should it be? Send seconds, from %d to %d.", pipeline.MinClipDuration, pipeline.MaxClipDuration), telegram.SendOptions{})
+	}
+}
+
+// previewNudges are the re-cut buttons shown under a preview: they shift the start or
+// change the duration by the given number of seconds.
+var previewNudges = []struct {
+	action          string
+	text            string
+	start, duration int
+}{
+	{"s-5", "⏪ −5s", -5, 0},
+	{"s+5", "⏩ +5s", 5, 0},
+	{"d-10", "✂️ −10s", 0, -10},
+	{"d+10", "➕ +10s", 0, 10},
+}
+
+func approvalKeyboard(previewID string) *telegram.InlineKeyboardMarkup {
+	nudges := make([]telegram.InlineKeyboardButton, 0, len(previewNudges))
+	for _, nudge := range previewNudges {
+		nudges = append(nudges, telegram.InlineKeyboardButton{Text: nudge.text, CallbackData: nudge.action + ":" + previewID})
+	}
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{
+		nudges,
+		{
+			{Text: "✅ Approve", CallbackData: "approve:" + previewID},
+			{Text: "🗑 Discard", CallbackData: "discard:" + previewID},
+		},
+	}}
+}
+
+// makePreview hands the resolve/download/cut pipeline to the worker pool and, once the
+// circle is ready, sends it privately with Approve/Discard buttons.
+func (b *Bot) makePreview(chatID int64, songURL string, start, duration int) {
+	b.nextID++
+	previewID := strconv.Itoa(b.nextID)
+
+	job, err := b.pool.Submit(songURL, pipeline.ClipRequest{
+		URL:      songURL,
+		Start:    start,
+		Duration: duration,
+	})
+	if err != nil {
+		b.reply(chatID, fmt.Sprintf("❌ %v", err), telegram.SendOptions{})
+		return
+	}
+	b.reply(chatID, fmt.Sprintf("⏳ Making a %d second circle from %s, starting at %s…", duration, songURL, pipeline.FormatDuration(start)), telegram.SendOptions{})
+
+	b.spawn(func() {
+		clip, err := job.Wait()
+		if err != nil {
+			job.Log.Error("Bot preview failed", "preview", previewID, "stage", pipeline.ErrorStage(err), "err", err)
+			b.reply(chatID, fmt.Sprintf("❌ %v", err), telegram.SendOptions{})
+			os.RemoveAll(job.WorkDir)
+			return
+		}
+		preview := &botPreview{
+			id:     previewID,
+			chatID: chatID,
+			clip:   clip,
+			data:   b.pipeline.MessageData(clip, b.cfg, b.destinations),
+		}
+		if !b.sendPreview(preview) {
+			os.RemoveAll(job.WorkDir)
+			return
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		preview.touched = time.Now()
+		b.previews[preview.id] = preview
+	})
+}
+
+// replyJobs lists the circles the worker pool is still making.
+func (b *Bot) replyJobs(chatID int64) {
+	jobs := b.pool.Active()
+	if len(jobs) == 0 {
+		b.reply(chatID, "Nothing is being made right now.", telegram.SendOptions{})
+		return
+	}
+	var sb strings.Builder
+	for _, job := range jobs {
+		status, _ := job.Status()
+		fmt.Fprintf(&sb, "⏳ %s: %s for %s\n", job.Label, status, job.Elapsed().Round(time.Second))
+	}
+	b.reply(chatID, strings.TrimSpace(sb.String()), telegram.SendOptions{})
+}
+
+// sendPreview shows the link message as the first destination will see it, followed by
+// the circle carrying the approval buttons, and reports whether the circle was sent. The
+// circle is sent as a regular square video because video notes cannot be replaced with
+// editMessageMedia after a re-cut.
+func (b *Bot) sendPreview(preview *botPreview) bool {
+	chat := strconv.FormatInt(preview.chatID, 10)
+	first := b.destinations[0]
+	if text, err := pipeline.RenderMessage(first.MessageTemplate, first.ParseMode, preview.data); err != nil {
+		b.reply(preview.chatID, fmt.Sprintf("⚠️ The message template failed: %v", err), telegram.SendOptions{})
+	} else if _, err := b.tg.SendMessage(chat, text, first.ParseMode, true, telegram.SendOptions{}); err != nil {
+		slog.Warn("Failed to send preview message", "preview", preview.id, "err", err)
+	}
+
+	req := preview.clip.Request
+	message, err := b.tg.SendVideo(chat, preview.clip.Path, previewCaption(req), pipeline.VideoNoteLength, req.Duration, telegram.SendOptions{ReplyMarkup: approvalKeyboard(preview.id)})
+	if err != nil {
+		slog.Error("Failed to send preview video", "preview", preview.id, "err", err)
+		b.reply(preview.chatID, fmt.Sprintf("❌ Failed to send the preview: %v", err), telegram.SendOptions{})
+		return false
+	}
+	preview.messageID = message.MessageID
+	return true
+}
+
+func previewCaption(req pipeline.ClipRequest) string {
+	return fmt.Sprintf("%s from %s", pipeline.FormatDuration(req.Duration), pipeline.FormatDuration(req.Start))
+}
+
+// nudgeCut applies a start and duration change to req, keeping the start non-negative and
+// the duration within the video note limits.
+func nudgeCut(req pipeline.ClipRequest, startDelta, durationDelta int) (start, duration int) {
+	start = max(req.Start+startDelta, 0)
+	duration = min(max(req.Duration+durationDelta, pipeline.MinClipDuration), pipeline.MaxClipDuration)
+	return start, duration
+}
+
+// recutPreview cuts the already downloaded source of a preview again and replaces the
+// preview video in place. It runs without holding mu, while the preview is busy.
+func (b *Bot) recutPreview(preview *botPreview, start, duration int) error {
+	clip := preview.clip
+	if err := b.pool.Encode(func() error {
+		return b.pipeline.Transcoder.Cut(clip.SourcePath, clip.Path, start, duration, nil)
+	}); err != nil {
+		return fmt.Errorf("failed to re-cut video: %w", err)
+	}
+	clip.Request.Start, clip.Request.Duration = start, duration
+	preview.data.Start, preview.data.DurationSeconds = start, duration
+
+	chat := strconv.FormatInt(preview.chatID, 10)
+	_, err := b.tg.EditMessageVideo(chat, preview.messageID, clip.Path, previewCaption(clip.Request), pipeline.VideoNoteLength, duration, telegram.SendOptions{ReplyMarkup: approvalKeyboard(preview.id)})
+	return err
+}
+
+func (b *Bot) handleCallback(query *telegram.CallbackQuery) {
+	action, previewID, _ := strings.Cut(query.Data, ":")
+	if strings.HasPrefix(action, "rv-") {
+		b.handleReviewCallback(query, action, previewID)
+		return
+	}
+	if !b.isAllowed(&query.From) {
+		b.answerCallback(query.ID, "You are not allowed to do this.")
+		return
+	}
+
+	preview, ok := b.previews[previewID]
+	if !ok {
+		b.answerCallback(query.ID, "This preview has expired.")
+		return
+	}
+	if preview.busy {
+		b.answerCallback(query.ID, "This preview is being worked on, try again in a moment.")
+		return
+	}
+	preview.touched = time.Now()
+
+	for _, nudge := range previewNudges {
+		if action != nudge.action {
+			continue
+		}
+		start, duration := nudgeCut(preview.clip.Request, nudge.start, nudge.duration)
+		if start == preview.clip.Request.Start && duration == preview.clip.Request.Duration {
+			b.answerCallback(query.ID, "Already at the limit.")
+			return
+		}
+		b.answerCallback(query.ID, "Re-cutting…")
+		b.removeKeyboard(preview)
+		preview.busy = true
+		b.spawn(func() {
+			if err := b.recutPreview(preview, start, duration); err != nil {
+				slog.Error("Re-cut of preview failed", "preview", preview.id, "err", err)
+				b.reply(preview.chatID, fmt.Sprintf("❌ %v", err), telegram.SendOptions{})
+				b.setKeyboard(preview, approvalKeyboard(preview.id))
+			}
+			b.doneWithPreview(preview, false)
+		})
+		return
+	}
+
+	switch action {
+	case "approve", "force":
+		if action == "force" {
+			b.answerCallback(query.ID, "Publishing anyway…")
+		} else {
+			b.answerCallback(query.ID, "Publishing…")
+		}
+		b.removeKeyboard(preview)
+		preview.busy = true
+		b.spawn(func() {
+			b.doneWithPreview(preview, b.publishPreview(preview, action == "force"))
+		})
+	case "discard":
+		b.answerCallback(query.ID, "Discarded.")
+		b.removeKeyboard(preview)
+		b.dropPreview(preview)
+	default:
+		b.answerCallback(query.ID, "Unknown action.")
+	}
+}
+
+// publishPreview posts an approved preview and reports whether it is done with. If the
+// track was already posted to one of the destinations recently, nothing is posted until the
+// user confirms with force. It runs without holding mu, while the preview is busy.
+func (b *Bot) publishPreview(preview *botPreview, force bool) bool {
+	clip := preview.clip
+	_, refused := filterDuplicates(b.cfg, b.historyPath, clipHistoryEntry(clip), b.destinations, force)
+	if len(refused) > 0 {
+		names := make([]string, 0, len(refused))
+		for _, d := range refused {
+			names = append(names, d.Name)
+		}
+		b.setKeyboard(preview, &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+			{Text: "⚠️ Publish anyway", CallbackData: "force:" + preview.id},
+			{Text: "🗑 Discard", CallbackData: "discard:" + preview.id},
+		}}})
+		b.reply(preview.chatID, fmt.Sprintf("⚠️ This track was already posted to %s recently. Publish it anyway?", strings.Join(names, ", ")), telegram.SendOptions{})
+		return false
+	}
+
+	direct, moderated := splitModerated(b.cfg, b.destinations)
+	results := b.pipeline.Publish(direct, preview.data, clip.Path, "", pipeline.VideoNoteLength, clip.Request.Duration)
+	failed := recordPublishResults(b.historyPath, clipHistoryEntry(clip), results)
+
+	var sb strings.Builder
+	if len(moderated) > 0 {
+		job := &ScheduledJob{
+			Destinations: moderated,
+			Data:         preview.data,
+			Length:       pipeline.VideoNoteLength,
+			Duration:     clip.Request.Duration,
+			History:      clipHistoryEntry(clip),
+		}
+		if err := submitForReview(b.cfg, b.queueDir, job, clip.Path, clip.SourcePath, clip.FilenameBase); err != nil {
+			failed++
+			fmt.Fprintf(&sb, "❌ Failed to submit for review: %v\n", err)
+		} else {
+			fmt.Fprintf(&sb, "👀 Sent to moderators for %s\n", jobDestinationNames(job))
+		}
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(&sb, "❌ %s: %v\n", result.Destination.Name, result.Err)
+		} else {
+			fmt.Fprintf(&sb, "✅ %s\n", result.Destination.Name)
+		}
+	}
+	b.reply(preview.chatID, strings.TrimSpace(sb.String()), telegram.SendOptions{})
+
+	if failed > 0 {
+		// Keep the preview so it can be approved again once the problem is fixed.
+		b.setKeyboard(preview, approvalKeyboard(preview.id))
+		return false
+	}
+	return true
+}
+
+// doneWithPreview ends the background work on a preview, and drops it if drop is set.
+func (b *Bot) doneWithPreview(preview *botPreview, drop bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	preview.busy = false
+	preview.touched = time.Now()
+	if drop {
+		b.dropPreview(preview)
+	}
+}
+
+func (b *Bot) dropPreview(preview *botPreview) {
+	delete(b.previews, preview.id)
+	if err := os.RemoveAll(preview.clip.Request.WorkDir); err != nil {
+		slog.Warn("Failed to remove preview files", "preview", preview.id, "err", err)
+	}
+}
+
+// expirePreviews drops previews left alone for longer than previewTTL, with their files,
+// until ctx is cancelled.
+func (b *Bot) expirePreviews(ctx context.Context) {
+	ticker := time.NewTicker(min(b.previewTTL, 10*time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			b.expirePreviewsAt(now)
+		}
+	}
+}
+
+func (b *Bot) expirePreviewsAt(now time.Time) {
+	b.mu.Lock()
+	var expired []*botPreview
+	for _, preview := range b.previews {
+		if !preview.busy && now.Sub(preview.touched) > b.previewTTL {
+			expired = append(expired, preview)
+			b.dropPreview(preview)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, preview := range expired {
+		slog.Info("Preview expired", "preview", preview.id, "chat_id", preview.chatID)
+		b.removeKeyboard(preview)
+	}
+}
+
+func (b *Bot) answerCallback(queryID, text string) {
+	params := url.Values{}
+	params.Add("callback_query_id", queryID)
+	if text != "" {
+		params.Add("text", text)
+	}
+	if err := b.tg.Call(context.Background(), "answerCallbackQuery", params, nil); err != nil {
+		slog.Warn("Failed to answer callback query", "err", err)
+	}
+}
+
+func (b *Bot) removeKeyboard(preview *botPreview) {
+	b.setKeyboard(preview, &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{}})
+}
+
+func (b *Bot) setKeyboard(preview *botPreview, markup *telegram.InlineKeyboardMarkup) {
+	b.setKeyboardOn(preview.chatID, preview.messageID, markup)
+}
+
+func (b *Bot) setKeyboardOn(chatID int64, messageID int, markup *telegram.InlineKeyboardMarkup) {
+	params := url.Values{}
+	params.Add("chat_id", strconv.FormatInt(chatID, 10))
+	params.Add("message_id", strconv.Itoa(messageID))
+	telegram.SendOptions{ReplyMarkup: markup}.Apply(params.Add)
+	if err := b.tg.Call(context.Background(), "editMessageReplyMarkup", params, nil); err != nil {
+		slog.Warn("Failed to edit reply markup", "chat_id", chatID, "message_id", messageID, "err", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+// addPreview registers a preview of a 30 second clip from 1:00 with its files in a fresh
+// work directory, as makePreview does once the circle is sent.
+func addPreview(t *testing.T, bot *Bot, id string) *botPreview {
+	t.Helper()
+	workDir := filepath.Join(t.TempDir(), "job")
+	if err := os.MkdirAll(workDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	clip := &pipeline.Clip{
+		Request:    pipeline.ClipRequest{URL: "https://song.link/s/1", Start: 60, Duration: 30, WorkDir: workDir},
+		SourcePath: filepath.Join(workDir, "song.mp4"),
+		Path:       filepath.Join(workDir, "song_cut.mp4"),
+	}
+	for _, path := range []string{clip.SourcePath, clip.Path} {
+		if err := os.WriteFile(path, []byte("video"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	preview := &botPreview{id: id, chatID: testUserID, messageID: 9, clip: clip, touched: time.Now()}
+	bot.previews[id] = preview
+	return preview
+}
+
+func previewCallback(data string) telegram.Update {
+	return telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:      "cb-" + data,
+		From:    telegram.User{ID: testUserID, FirstName: "Test"},
+		Message: &telegram.Message{MessageID: 9, Chat: telegram.Chat{ID: testUserID, Type: "private"}},
+		Data:    data,
+	}}
+}
+
+func TestRecutPreviewDoesNotBlockUpdates(t *testing.T) {
+	bot, srv := newTestBot(t)
+	transcoder := newBlockingTranscoder()
+	bot.pipeline.Transcoder = transcoder
+	preview := addPreview(t, bot, "1")
+
+	handleSoon(t, bot, previewCallback("s+5:1"))
+	<-transcoder.started
+
+	// While the re-cut is encoding, other updates are handled and the preview takes no
+	// other action.
+	handleSoon(t, bot, privateMessage(testUserID, "/help"))
+	handleSoon(t, bot, previewCallback("approve:1"))
+	answers := srv.Requests("answerCallbackQuery")
+	if len(answers) != 2 || answers[1].Params.Get("text") != "This preview is being worked on, try again in a moment." {
+		t.Errorf("approving during a re-cut was answered with %v", answers)
+	}
+
+	close(transcoder.release)
+	bot.wg.Wait()
+
+	if edits := srv.Requests("editMessageMedia"); len(edits) != 1 {
+		t.Fatalf("got %d preview replacements, want 1", len(edits))
+	}
+	if preview.clip.Request.Start != 65 || preview.busy {
+		t.Errorf("preview after re-cut: start %d, busy %v", preview.clip.Request.Start, preview.busy)
+	}
+	if _, ok := bot.previews["1"]; !ok {
+		t.Error("preview dropped after a re-cut")
+	}
+}
+
+func TestPreviewsExpire(t *testing.T) {
+	bot, srv := newTestBot(t)
+	old := addPreview(t, bot, "1")
+	old.touched = time.Now().Add(-2 * bot.previewTTL)
+	busy := addPreview(t, bot, "2")
+	busy.touched = old.touched
+	busy.busy = true
+	fresh := addPreview(t, bot, "3")
+
+	bot.expirePreviewsAt(time.Now())
+
+	if _, ok := bot.previews["1"]; ok {
+		t.Error("old preview kept")
+	}
+	if _, err := os.Stat(old.clip.Request.WorkDir); !os.IsNotExist(err) {
+		t.Errorf("old preview's files kept: %v", err)
+	}
+	for _, preview := range []*botPreview{busy, fresh} {
+		if _, ok := bot.previews[preview.id]; !ok {
+			t.Errorf("preview %s dropped", preview.id)
+		}
+	}
+	if edits := srv.Requests("editMessageReplyMarkup"); len(edits) != 1 {
+		t.Errorf("got %d keyboard removals, want 1", len(edits))
+	}
+
+	handleSoon(t, bot, previewCallback("approve:1"))
+	if answers := srv.Requests("answerCallbackQuery"); len(answers) != 1 || answers[0].Params.Get("text") != "This preview has expired." {
+		t.Errorf("approving an expired preview was answered with %v", answers)
+	}
+}
+
+func TestApprovePreviewPublishes(t *testing.T) {
+	bot, srv := newTestBot(t)
+	preview := addPreview(t, bot, "1")
+
+	handleSoon(t, bot, previewCallback("approve:1"))
+	bot.wg.Wait()
+
+	notes := srv.Requests("sendVideoNote")
+	if len(notes) != 1 || notes[0].Params.Get("chat_id") != "@channel" || notes[0].Err != "" {
+		t.Fatalf("got %d video notes (%v), want one in @channel", len(notes), notes)
+	}
+	if _, ok := bot.previews["1"]; ok {
+		t.Error("published preview kept")
+	}
+	if _, err := os.Stat(preview.clip.Request.WorkDir); !os.IsNotExist(err) {
+		t.Errorf("published preview's files kept: %v", err)
+	}
+}
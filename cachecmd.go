@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+var cacheCmd = &command{
+	name:    "cache",
+	args:    "[action] [flags]",
+	summary: "list or remove leftover working directories",
+	about: "Every clip is made in its own directory under temp/ (bot.work_dir for the bot). They are\n" +
+		"removed once the clip is published, but stay behind with -r=false or after an interrupted run.",
+	actions: []commandAction{
+		{"list", "[flags]", "show the working directories with their size and age"},
+		{"clean", "[flags]", "remove working directories not touched within -older-than"},
+	},
+	defaultAction: "list",
+	config:        true,
+	setup:         setupCache,
+}
+
+// cacheEntry is a job directory, or a stray file, in a working directory.
+type cacheEntry struct {
+	path     string
+	size     int64
+	modified time.Time
+}
+
+func setupCache(flags *flag.FlagSet, common *commonFlags) func(string) {
+	dirFlag := flags.String("dir", defaultWorkDir, "Working directory of make and batch")
+	olderThanFlag := flags.Duration("older-than", 24*time.Hour, "With clean: only remove directories not modified for this long, so running jobs and open bot previews are kept")
+
+	return func(action string) {
+		dirs := []string{*dirFlag, defaultBotWorkDir}
+		// The config only matters for the bot's working directory, so don't insist on one.
+		if cfg, _, err := common.loadConfig(); err == nil && cfg.Bot.WorkDir != "" {
+			dirs[1] = cfg.Bot.WorkDir
+		} else if err != nil && common.config != "" {
+			fatal(exitFailure, "Failed to load config", "err", err)
+		}
+
+		entries, err := listCache(dirs)
+		if err != nil {
+			fatal(exitFailure, "Failed to list working directories", "err", err)
+		}
+
+		switch action {
+		case "list":
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PATH\tSIZE\tMODIFIED")
+			var total int64
+			for _, e := range entries {
+				total += e.size
+				fmt.Fprintf(w, "%s\t%s\t%s\n", e.path, formatSize(e.size), e.modified.Format("2006-01-02 15:04"))
+			}
+			w.Flush()
+			fmt.Printf("\n%d entries, %s in total\n", len(entries), formatSize(total))
+		case "clean":
+			cutoff := time.Now().Add(-*olderThanFlag)
+			removed, kept := 0, 0
+			var freed int64
+			for _, e := range entries {
+				if e.modified.After(cutoff) {
+					kept++
+					continue
+				}
+				if err := os.RemoveAll(e.path); err != nil {
+					slog.Warn("Failed to remove working directory", "path", e.path, "err", err)
+					continue
+				}
+				removed++
+				freed += e.size
+			}
+			fmt.Printf("✅ Removed %d entries, freeing %s", removed, formatSize(freed))
+			if kept > 0 {
+				fmt.Printf("; kept %d modified within %s", kept, *olderThanFlag)
+			}
+			fmt.Println(".")
+		}
+	}
+}
+
+// listCache returns what is inside the working directories, oldest first. A working
+// directory nested in another, like temp/bot in temp, is listed on its own rather than
+// as an entry of its parent.
+func listCache(dirs []string) ([]cacheEntry, error) {
+	for i, dir := range dirs {
+		dirs[i] = filepath.Clean(dir)
+	}
+	var entries []cacheEntry
+	for i, dir := range dirs {
+		if slices.Contains(dirs[:i], dir) {
+			continue
+		}
+		items, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			path := filepath.Join(dir, item.Name())
+			if slices.Contains(dirs, path) {
+				continue
+			}
+			entry, err := statCacheEntry(path)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b cacheEntry) int { return a.modified.Compare(b.modified) })
+	return entries, nil
+}
+
+// statCacheEntry adds up the size of everything under path and finds when any of it was
+// last modified.
+func statCacheEntry(path string) (cacheEntry, error) {
+	entry := cacheEntry{path: path}
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			entry.size += info.Size()
+		}
+		if info.ModTime().After(entry.modified) {
+			entry.modified = info.ModTime()
+		}
+		return nil
+	})
+	return entry, err
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
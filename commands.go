@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+// Exit codes, so scripts can tell which stage of making a circle went wrong.
+const (
+	exitFailure  = 1
+	exitUsage    = 2
+	exitResolve  = 3
+	exitDownload = 4
+	exitEncode   = 5
+	exitPublish  = 6
+)
+
+// command is a subcommand such as make or history.
+type command struct {
+	name string
+	// args is the synopsis shown after the name, e.g. "[flags] <file>".
+	args    string
+	summary string
+	// about is printed under the usage line by -h.
+	about string
+	// actions are the words accepted as the first argument. If there are any, one must
+	// be given unless defaultAction is set.
+	actions       []commandAction
+	defaultAction string
+	// config is set for commands that read config.json; they get the -config flag.
+	config bool
+	// events is set for commands that can report what they do as JSON events; they get
+	// the -output flag.
+	events bool
+	// noLogFlags is set for commands that only print, like help; they don't get -v, -q
+	// and -log-file.
+	noLogFlags bool
+	// setup defines the command's flags on fs and returns the function that runs the
+	// command once they have been parsed.
+	setup func(fs *flag.FlagSet, common *commonFlags) func(action string)
+}
+
+type commandAction struct {
+	name, args, summary string
+}
+
+// commonFlags are the flags every command that needs them defines the same way.
+type commonFlags struct {
+	config  string
+	output  string
+	verbose bool
+	quiet   bool
+	logFile string
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet, cmd *command) {
+	if cmd.config {
+		fs.StringVar(&c.config, "config", "", configFlagUsage)
+	}
+	if cmd.events {
+		fs.StringVar(&c.output, "output", outputText, "Output format: text, or json for newline-delimited JSON events on stdout")
+	}
+	if !cmd.noLogFlags {
+		fs.BoolVar(&c.verbose, "v", false, "Log debug details as well")
+		fs.BoolVar(&c.quiet, "q", false, "Only log warnings and errors")
+		fs.StringVar(&c.logFile, "log-file", "", "Also append the log, with debug details, to this file as JSON")
+	}
+}
+
+// apply acts on the common flags once they have been parsed.
+func (c *commonFlags) apply() error {
+	if c.verbose && c.quiet {
+		return errors.New("-v and -q can't be combined")
+	}
+	level := slog.LevelInfo
+	if c.verbose {
+		level = slog.LevelDebug
+	} else if c.quiet {
+		level = slog.LevelWarn
+	}
+	logger, err := logging.New(os.Stderr, logging.Options{Level: level, File: c.logFile})
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	switch c.output {
+	case "", outputText:
+		return nil
+	case outputJSON:
+		return startEvents()
+	}
+	return fmt.Errorf("unknown output format %q, want %s or %s", c.output, outputText, outputJSON)
+}
+
+// loadConfig loads config.json from -config, or from where config.LoadFrom looks for it,
+// and keeps its secrets out of the log.
+func (c *commonFlags) loadConfig() (*config.Config, string, error) {
+	cfg, path, err := config.LoadFrom(c.config)
+	if err != nil {
+		return nil, "", err
+	}
+	logging.AddSecret(cfg.BotToken)
+	logging.AddSecret(cfg.Bot.WebhookSecret)
+	return cfg, path, nil
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		makeCmd,
+		previewCmd,
+		publishCmd,
+		batchCmd,
+		botCmd,
+		daemonCmd,
+		repostCmd,
+		historyCmd,
+		cacheCmd,
+		configCmd,
+		initCmd,
+		fixturesCmd,
+		completionCmd,
+		helpCmd,
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// programName is how the tool was invoked, for help text and completion scripts.
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// flagSet returns the command's flags along with the function that runs it.
+func (cmd *command) flagSet() (*flag.FlagSet, func(action string)) {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	common := &commonFlags{}
+	common.register(fs, cmd)
+	run := cmd.setup(fs, common)
+	// Keep usage on stderr even after -output=json has silenced it.
+	stderr := os.Stderr
+	fs.Usage = func() { cmd.printUsage(stderr, fs) }
+	return fs, func(action string) {
+		if err := common.apply(); err != nil {
+			slog.Error(err.Error())
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		run(action)
+	}
+}
+
+// run parses args and runs the command.
+func (cmd *command) run(args []string) {
+	fs, run := cmd.flagSet()
+	action := cmd.defaultAction
+	if len(cmd.actions) > 0 {
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			action, args = args[0], args[1:]
+		}
+		if action == "" {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		if !slices.ContainsFunc(cmd.actions, func(a commandAction) bool { return a.name == action }) {
+			slog.Error("Unknown action", "command", cmd.name, "action", action)
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+	}
+	fs.Parse(args)
+	run(action)
+}
+
+func (cmd *command) printUsage(w io.Writer, fs *flag.FlagSet) {
+	prog := programName()
+	synopsis := strings.TrimSpace(strings.Join([]string{prog, cmd.name, cmd.args}, " "))
+	fmt.Fprintf(w, "Usage: %s\n\n", synopsis)
+	if cmd.about != "" {
+		fmt.Fprintf(w, "%s\n\n", cmd.about)
+	} else {
+		fmt.Fprintf(w, "%s%s.\n\n", strings.ToUpper(cmd.summary[:1]), cmd.summary[1:])
+	}
+	if len(cmd.actions) > 0 {
+		fmt.Fprintln(w, "Actions:")
+		for _, a := range cmd.actions {
+			name := strings.TrimSpace(a.name + " " + a.args)
+			if a.name == cmd.defaultAction {
+				name += " (default)"
+			}
+			fmt.Fprintf(w, "  %-28s %s\n", name, a.summary)
+		}
+		fmt.Fprintln(w)
+	}
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(w, "Flags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+		fs.SetOutput(nil)
+	}
+}
+
+// printMainUsage lists every command.
+func printMainUsage(w io.Writer) {
+	prog := programName()
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\n", prog)
+	fmt.Fprintf(w, "Cuts a fragment of a song into a Telegram video note and publishes it.\n\n")
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command. Flags without a command run make.\n", prog)
+	fmt.Fprintf(w, "\nExit codes: %d other failure, %d usage error, %d link not resolved, %d download failed,\n", exitFailure, exitUsage, exitResolve, exitDownload)
+	fmt.Fprintf(w, "%d encoding failed, %d publishing failed.\n", exitEncode, exitPublish)
+}
+
+// stageExitCode returns the exit code for an error from making a clip.
+func stageExitCode(err error) int {
+	switch pipeline.ErrorStage(err) {
+	case pipeline.StageResolve:
+		return exitResolve
+	case pipeline.StageDownload:
+		return exitDownload
+	case pipeline.StageEncode:
+		return exitEncode
+	case pipeline.StagePublish:
+		return exitPublish
+	}
+	return exitFailure
+}
+
+// fatal logs msg at error level with the attributes in args, like slog.Error, and exits
+// with code. With -output=json it also writes an error event.
+func fatal(code int, msg string, args ...any) {
+	slog.Error(msg, args...)
+	text := msg
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			text += ": " + err.Error()
+		}
+	}
+	events.emit(event{Type: "error", Stage: codeStage(code), Code: code, Error: text})
+	os.Exit(code)
+}
+
+var helpCmd = &command{
+	name:       "help",
+	args:       "[command]",
+	summary:    "show the commands, or the flags of one",
+	noLogFlags: true,
+	setup: func(fs *flag.FlagSet, _ *commonFlags) func(string) {
+		return func(string) {
+			if fs.NArg() == 0 {
+				printMainUsage(os.Stdout)
+				return
+			}
+			cmd := findCommand(fs.Arg(0))
+			if cmd == nil {
+				slog.Error("Unknown command", "command", fs.Arg(0))
+				printMainUsage(os.Stderr)
+				os.Exit(exitUsage)
+			}
+			cmdFlags, _ := cmd.flagSet()
+			cmd.printUsage(os.Stdout, cmdFlags)
+		}
+	},
+}
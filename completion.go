@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var completionCmd = &command{
+	name:    "completion",
+	args:    "<shell> [flags]",
+	summary: "print a shell completion script",
+	about: fmt.Sprintf("Prints a script that completes commands, actions and flags.\n\n"+
+		"  bash: source <(%[1]s completion bash)   (or save it to /etc/bash_completion.d/)\n"+
+		"  zsh:  %[1]s completion zsh > \"${fpath[1]}/_%[1]s\"\n"+
+		"  fish: %[1]s completion fish > ~/.config/fish/completions/%[1]s.fish", programName()),
+	actions: []commandAction{
+		{"bash", "", "complete in bash"},
+		{"zsh", "", "complete in zsh"},
+		{"fish", "", "complete in fish"},
+	},
+	noLogFlags: true,
+	setup:      setupCompletion,
+}
+
+func setupCompletion(fs *flag.FlagSet, _ *commonFlags) func(string) {
+	nameFlag := fs.String("name", programName(), "Name of the executable to complete")
+
+	return func(shell string) {
+		specs := completionSpecs()
+		switch shell {
+		case "bash":
+			writeBashCompletion(os.Stdout, *nameFlag, specs)
+		case "zsh":
+			writeZshCompletion(os.Stdout, *nameFlag, specs)
+		case "fish":
+			writeFishCompletion(os.Stdout, *nameFlag, specs)
+		}
+	}
+}
+
+// completionSpec is what can be completed after a command name.
+type completionSpec struct {
+	cmd   *command
+	flags []*flag.Flag
+}
+
+func completionSpecs() []completionSpec {
+	var specs []completionSpec
+	for _, cmd := range commands {
+		fs, _ := cmd.flagSet()
+		spec := completionSpec{cmd: cmd}
+		fs.VisitAll(func(f *flag.Flag) { spec.flags = append(spec.flags, f) })
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func (s completionSpec) flagNames() string {
+	names := make([]string, len(s.flags))
+	for i, f := range s.flags {
+		names[i] = "-" + f.Name
+	}
+	return strings.Join(names, " ")
+}
+
+func (s completionSpec) actionNames() string {
+	names := make([]string, len(s.cmd.actions))
+	for i, a := range s.cmd.actions {
+		names[i] = a.name
+	}
+	return strings.Join(names, " ")
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// completionFunc names the shell function for prog, which may contain dots or dashes.
+func completionFunc(prog string) string {
+	return "_" + nonIdentifier.ReplaceAllString(prog, "_")
+}
+
+// flagSummary is the first sentence of a flag's usage, short enough for a completion menu.
+func flagSummary(f *flag.Flag) string {
+	usage, _, _ := strings.Cut(f.Usage, " (")
+	usage, _, _ = strings.Cut(usage, ". ")
+	usage, _, _ = strings.Cut(usage, "; ")
+	return usage
+}
+
+// shellQuote quotes s in single quotes for bash, zsh and fish.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeBashCompletion(w io.Writer, prog string, specs []completionSpec) {
+	fn := completionFunc(prog)
+	var names []string
+	for _, s := range specs {
+		names = append(names, s.cmd.name)
+	}
+
+	fmt.Fprintf(w, "# bash completion for %s\n", prog)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} flags= actions=\n")
+	fmt.Fprintf(w, "\tif [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(names, " ")))
+	fmt.Fprintf(w, "\t\treturn\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "\tcase ${COMP_WORDS[1]} in\n")
+	for _, s := range specs {
+		fmt.Fprintf(w, "\t%s) flags=%s actions=%s ;;\n", s.cmd.name, shellQuote(s.flagNames()), shellQuote(s.actionNames()))
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tif [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telif [[ $COMP_CWORD -eq 2 && -n $actions ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$actions\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telse\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, prog)
+}
+
+func writeZshCompletion(w io.Writer, prog string, specs []completionSpec) {
+	fn := completionFunc(prog)
+	// _describe splits "name:description" at the first colon.
+	describe := func(name, description string) string {
+		return shellQuote(name + ":" + description)
+	}
+
+	fmt.Fprintf(w, "#compdef %s\n\n", prog)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "\tlocal -a commands flags actions\n")
+	fmt.Fprintf(w, "\tcommands=(\n")
+	for _, s := range specs {
+		fmt.Fprintf(w, "\t\t%s\n", describe(s.cmd.name, s.cmd.summary))
+	}
+	fmt.Fprintf(w, "\t)\n")
+	fmt.Fprintf(w, "\tif (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(w, "\t\t_describe command commands\n")
+	fmt.Fprintf(w, "\t\treturn\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "\tcase $words[2] in\n")
+	for _, s := range specs {
+		fmt.Fprintf(w, "\t%s)\n", s.cmd.name)
+		if len(s.flags) > 0 {
+			fmt.Fprintf(w, "\t\tflags=(")
+			for _, f := range s.flags {
+				fmt.Fprintf(w, " %s", describe("-"+f.Name, flagSummary(f)))
+			}
+			fmt.Fprintf(w, " )\n")
+		}
+		if len(s.cmd.actions) > 0 {
+			fmt.Fprintf(w, "\t\tactions=(")
+			for _, a := range s.cmd.actions {
+				fmt.Fprintf(w, " %s", describe(a.name, a.summary))
+			}
+			fmt.Fprintf(w, " )\n")
+		}
+		fmt.Fprintf(w, "\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tif [[ $PREFIX == -* ]]; then\n")
+	fmt.Fprintf(w, "\t\t_describe flag flags\n")
+	fmt.Fprintf(w, "\telif (( CURRENT == 3 && ${#actions} )); then\n")
+	fmt.Fprintf(w, "\t\t_describe action actions\n")
+	fmt.Fprintf(w, "\telse\n")
+	fmt.Fprintf(w, "\t\t_files\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "}\n\n")
+	fmt.Fprintf(w, "if [[ $zsh_eval_context[-1] == loadautofunc ]]; then\n")
+	fmt.Fprintf(w, "\t%s \"$@\"\n", fn)
+	fmt.Fprintf(w, "else\n")
+	fmt.Fprintf(w, "\tcompdef %s %s\n", fn, prog)
+	fmt.Fprintf(w, "fi\n")
+}
+
+func writeFishCompletion(w io.Writer, prog string, specs []completionSpec) {
+	fmt.Fprintf(w, "# fish completion for %s\n", prog)
+	for _, s := range specs {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -f -a %s -d %s\n", prog, s.cmd.name, shellQuote(s.cmd.summary))
+	}
+	for _, s := range specs {
+		seen := shellQuote("__fish_seen_subcommand_from " + s.cmd.name)
+		for _, a := range s.cmd.actions {
+			// Actions only come right after the command name.
+			cond := shellQuote(fmt.Sprintf("__fish_seen_subcommand_from %s; and test (count (commandline -opc)) -eq 2", s.cmd.name))
+			fmt.Fprintf(w, "complete -c %s -n %s -f -a %s -d %s\n", prog, cond, a.name, shellQuote(a.summary))
+		}
+		for _, f := range s.flags {
+			fmt.Fprintf(w, "complete -c %s -n %s -o %s -d %s\n", prog, seen, f.Name, shellQuote(flagSummary(f)))
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+)
+
+const configFlagUsage = "Path to config.json (default: ./config.json, then $XDG_CONFIG_HOME/tgcircle/config.json, then next to the executable)"
+
+var configCmd = &command{
+	name:    "config",
+	args:    "<action> [flags]",
+	summary: "check the configuration or show where it comes from",
+	actions: []commandAction{
+		{"validate", "[flags]", "check the bot token with getMe and every chat with getChat"},
+		{"path", "[flags]", "show which config file is used and where it is searched for"},
+		{"env", "", "list the " + config.EnvPrefix + "* environment variables that override config fields"},
+	},
+	config: true,
+	setup:  setupConfig,
+}
+
+// setupConfig shows where the config comes from or checks it against Telegram.
+func setupConfig(_ *flag.FlagSet, common *commonFlags) func(string) {
+	return func(action string) {
+		switch action {
+		case "validate":
+			cfg, path, err := common.loadConfig()
+			if err != nil {
+				fatal(exitFailure, "Failed to load config", "err", err)
+			}
+			if path == "" {
+				fmt.Println("Using configuration from the environment only.")
+			} else {
+				fmt.Printf("Using %s\n", path)
+			}
+			if !validateConfig(cfg) {
+				os.Exit(exitFailure)
+			}
+		case "path":
+			path, err := config.Find(common.config)
+			switch {
+			case err != nil:
+				fmt.Printf("No config file found: %v\n", err)
+			case path == "":
+				fmt.Println("No config file found; using the environment only.")
+			default:
+				fmt.Println(path)
+			}
+			fmt.Println("\nSearched, in order:")
+			for _, p := range config.SearchPaths() {
+				fmt.Printf("  %s\n", p)
+			}
+		case "env":
+			for _, name := range config.EnvVars() {
+				fmt.Println(name)
+			}
+		}
+	}
+}
+
+// configChat is a chat the config refers to, with where it is used.
+type configChat struct {
+	chatID string
+	usedBy string
+	// wantType is the destination type it was declared as, if any.
+	wantType string
+}
+
+// validateConfig checks the token and that the bot can see every configured chat.
+func validateConfig(cfg *config.Config) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if cfg.BotToken == "" {
+		fmt.Println("❌ bot_token is not set (use bot_token, bot_token_file, bot_token_command or TGCIRCLE_BOT_TOKEN)")
+		return false
+	}
+	tg := cfg.TelegramClient()
+	me, err := tg.GetMe(ctx)
+	if err != nil {
+		fmt.Printf("❌ bot_token: %s\n", logging.Redact(err.Error()))
+		return false
+	}
+	fmt.Printf("✅ bot_token belongs to @%s (%s)\n", me.Username, me.FirstName)
+
+	ok := true
+	for _, c := range configChats(cfg) {
+		chat, err := tg.GetChat(ctx, c.chatID)
+		if err != nil {
+			ok = false
+			fmt.Printf("❌ %s %s: %s\n", c.usedBy, c.chatID, logging.Redact(err.Error()))
+			continue
+		}
+		name := chat.Title
+		if name == "" && chat.Username != "" {
+			name = "@" + chat.Username
+		}
+		if problem := chatTypeProblem(c.wantType, chat.Type); problem != "" {
+			ok = false
+			fmt.Printf("❌ %s %s: %q is a %s, %s\n", c.usedBy, c.chatID, name, chat.Type, problem)
+			continue
+		}
+		fmt.Printf("✅ %s %s: %q (%s)\n", c.usedBy, c.chatID, name, chat.Type)
+	}
+	return ok
+}
+
+func configChats(cfg *config.Config) []configChat {
+	var chats []configChat
+	add := func(chatID, usedBy, wantType string) {
+		if chatID != "" {
+			chats = append(chats, configChat{chatID: chatID, usedBy: usedBy, wantType: wantType})
+		}
+	}
+	add(cfg.ChatID, "chat_id", "")
+	add(cfg.ChatIDTest, "chat_id_test", "")
+	for _, d := range cfg.Destinations {
+		if d.IsEnabled() {
+			add(d.ChatID, "destination "+d.Name, d.Type)
+		}
+	}
+	add(cfg.Moderation.ChatID, "moderation.chat_id", "")
+	return chats
+}
+
+// chatTypeProblem explains why a chat of Bot API type got can't serve as a destination of
+// type want, or returns "" if it can.
+func chatTypeProblem(want, got string) string {
+	switch want {
+	case config.DestinationChannel:
+		if got != "channel" {
+			return "but the destination is declared as a channel"
+		}
+	case config.DestinationGroup, config.DestinationTopic:
+		if got != "group" && got != "supergroup" {
+			return "but the destination is declared as a " + want
+		}
+	case config.DestinationPrivate:
+		if got != "private" {
+			return "but the destination is declared as a private chat"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+var daemonCmd = &command{
+	name:    "daemon",
+	args:    "[action] [flags]",
+	summary: "publish clips queued with -at when they are due",
+	about:   "Publishes scheduled jobs when they become due, or inspects and edits the queue.",
+	actions: []commandAction{
+		{"run", "[flags]", "publish due jobs until interrupted"},
+		{"list", "[flags]", "show pending and in-review jobs"},
+		{"cancel", "<job-id>...", "cancel pending jobs"},
+	},
+	defaultAction: "run",
+	config:        true,
+	setup:         setupDaemon,
+}
+
+// setupDaemon publishes scheduled jobs when they become due. With "list" or "cancel"
+// as the first argument it inspects or edits the queue instead.
+func setupDaemon(fs *flag.FlagSet, common *commonFlags) func(string) {
+	queueFlag := fs.String("queue", defaultQueueDir, "Directory holding scheduled jobs")
+	historyFlag := fs.String("history", defaultHistoryPath, "Path to the local history of posted video notes")
+	intervalFlag := fs.Duration("interval", 30*time.Second, "How often to check the queue for due jobs")
+	allFlag := fs.Bool("all", false, "With list: also show published, failed, cancelled and rejected jobs")
+
+	return func(action string) {
+		switch action {
+		case "run":
+			cfg, _, err := common.loadConfig()
+			if err != nil {
+				fatal(exitFailure, "Failed to load config", "err", err)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			runScheduler(ctx, cfg, *queueFlag, *historyFlag, *intervalFlag)
+		case "list":
+			listJobs(*queueFlag, *allFlag)
+		case "cancel":
+			if fs.NArg() == 0 {
+				slog.Error("cancel requires at least one job ID")
+				fs.Usage()
+				os.Exit(exitUsage)
+			}
+			failed := false
+			for _, id := range fs.Args() {
+				if err := cancelJob(*queueFlag, id); err != nil {
+					slog.Error("Failed to cancel job", "queue_job", id, "err", err)
+					failed = true
+					continue
+				}
+				fmt.Printf("✅ Cancelled %s\n", id)
+			}
+			if failed {
+				os.Exit(exitFailure)
+			}
+		}
+	}
+}
+
+func runScheduler(ctx context.Context, cfg *config.Config, queueDir, historyPath string, interval time.Duration) {
+	fmt.Printf("⏰ Watching %s for due jobs every %s. Press Ctrl+C to stop.\n", queueDir, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pl := pipeline.New(cfg, "")
+
+	for {
+		publishDueJobs(cfg, pl, queueDir, historyPath, time.Now())
+		select {
+		case <-ctx.Done():
+			fmt.Println("Daemon stopped.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDueJobs publishes every pending job whose time has come. Jobs are re-read from disk
+// on each pass, so jobs added or cancelled while the daemon runs are picked up, and a restart
+// simply resumes with whatever is still pending.
+func publishDueJobs(cfg *config.Config, pl *pipeline.Pipeline, queueDir, historyPath string, now time.Time) {
+	jobs, err := loadJobs(queueDir)
+	if err != nil {
+		slog.Warn("Failed to load queue", "err", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if job.Status != JobPending || job.PublishAt.After(now) {
+			continue
+		}
+		fmt.Printf("📤 Publishing job %s (due %s)\n", job.ID, job.PublishAt.Format(time.RFC3339))
+
+		// Jobs approved through review reuse the circle uploaded for the moderators.
+		results := pl.Publish(job.Destinations, job.Data, job.ClipPath(), job.FileID, job.Length, job.Duration)
+		failed := recordPublishResults(historyPath, job.History, results)
+
+		job.Attempts++
+		if failed == 0 {
+			publishedAt := time.Now()
+			job.Status = JobPublished
+			job.PublishedAt = &publishedAt
+			job.LastError = ""
+		} else {
+			// Retrying would repost to destinations that already succeeded, so only
+			// the failed ones are kept for the next attempt.
+			var remaining []config.Destination
+			var errs []string
+			for _, result := range results {
+				if result.Err != nil {
+					remaining = append(remaining, result.Destination)
+					errs = append(errs, result.Destination.Name+": "+logging.Redact(result.Err.Error()))
+				}
+			}
+			job.Destinations = remaining
+			job.LastError = strings.Join(errs, "; ")
+			if job.Attempts >= maxJobAttempts {
+				job.Status = JobFailed
+			}
+		}
+
+		if err := saveJob(job); err != nil {
+			slog.Warn("Failed to save job", "queue_job", job.ID, "err", err)
+			continue
+		}
+		if job.Status == JobPublished {
+			if err := job.removeMedia(); err != nil {
+				slog.Warn("Failed to remove job media", "queue_job", job.ID, "err", err)
+			}
+			fmt.Printf("✅ Job %s published.\n", job.ID)
+		} else {
+			fmt.Printf("❌ Job %s: %d of %d destinations failed (attempt %d/%d).\n", job.ID, failed, len(results), job.Attempts, maxJobAttempts)
+		}
+	}
+}
+
+func listJobs(queueDir string, all bool) {
+	jobs, err := loadJobs(queueDir)
+	if err != nil {
+		fatal(exitFailure, "Failed to load queue", "err", err)
+	}
+
+	var shown []*ScheduledJob
+	for _, job := range jobs {
+		if all || job.Status == JobPending || job.Status == JobAwaitingReview {
+			shown = append(shown, job)
+		}
+	}
+	if len(shown) == 0 {
+		fmt.Println("No jobs in queue.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPUBLISH AT\tSTATUS\tDESTINATIONS\tTRACK")
+	for _, job := range shown {
+		var names []string
+		for _, d := range job.Destinations {
+			names = append(names, d.Name)
+		}
+		track := job.History.Title
+		if job.History.Artist != "" {
+			track = fmt.Sprintf("%s by %s", track, job.History.Artist)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.ID, job.PublishAt.Local().Format("2006-01-02 15:04"), job.Status, strings.Join(names, ","), track)
+	}
+	w.Flush()
+}
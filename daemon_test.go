@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+func TestPublishDueJobsReusesReviewFileID(t *testing.T) {
+	bot, srv := newTestBot(t)
+	bot.cfg.Moderation.ChatID = "-300"
+	clipPath := filepath.Join(t.TempDir(), "song.mp4")
+	if err := os.WriteFile(clipPath, []byte("video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	destinations, err := pipeline.ApplyMessageTemplates([]config.Destination{{Name: "main", ChatID: "@channel", Moderated: true}}, bot.cfg, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &ScheduledJob{
+		PublishAt:    time.Now().Add(time.Hour),
+		Destinations: destinations,
+		Data:         pipeline.MessageData{Display: "Song", URL: "https://song.link/s/1"},
+		Length:       pipeline.VideoNoteLength,
+		Duration:     30,
+	}
+	if err := submitForReview(bot.cfg, bot.queueDir, job, clipPath, "", "song"); err != nil {
+		t.Fatal(err)
+	}
+	if job.FileID == "" {
+		t.Fatal("the review preview left no file_id")
+	}
+	bot.approveJob(job, "@mod")
+
+	publishDueJobs(bot.cfg, bot.pipeline, bot.queueDir, bot.historyPath, job.PublishAt.Add(time.Minute))
+
+	notes := srv.Requests("sendVideoNote")
+	if len(notes) != 2 {
+		t.Fatalf("got %d sendVideoNote calls, want the review preview and the post", len(notes))
+	}
+	post := notes[1]
+	if post.Err != "" {
+		t.Fatalf("post failed: %s", post.Err)
+	}
+	if _, uploaded := post.Files["video_note"]; uploaded || post.Params.Get("video_note") != job.FileID {
+		t.Errorf("the approved job was uploaded again instead of sent by file_id %s", job.FileID)
+	}
+	saved, err := loadJob(bot.queueDir, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != JobPublished {
+		t.Errorf("job status %s, want %s", saved.Status, JobPublished)
+	}
+}
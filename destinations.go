@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+// stringListFlag collects values of a repeatable, comma-separated flag.
+type stringListFlag []string
+
+func (l *stringListFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringListFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// recordPublishResults prints a status line per destination and appends every successful
+// post to history. base carries the track details shared by all destinations.
+// It returns the number of destinations that failed.
+func recordPublishResults(historyPath string, base HistoryEntry, results []pipeline.PublishResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("❌ %s (%s): %s\n", result.Destination.Name, result.Destination.ChatID, logging.Redact(result.Err.Error()))
+			slog.Debug("Publishing failed", "destination", result.Destination.Name, "chat_id", result.Destination.ChatID, "err", result.Err)
+			continue
+		}
+		fmt.Printf("✅ %s (%s): link message %d, video note %d\n", result.Destination.Name, result.Destination.ChatID, result.LinkMessageID, result.VideoNote.MessageID)
+
+		if result.VideoNote.VideoNote == nil || result.VideoNote.VideoNote.FileID == "" {
+			slog.Warn("Telegram response has no video_note file_id, history not recorded", "destination", result.Destination.Name)
+			continue
+		}
+		entry := base
+		entry.PostedAt = time.Now()
+		entry.Destination = result.Destination.Name
+		entry.ChatID = result.Destination.ChatID
+		entry.MessageID = result.VideoNote.MessageID
+		entry.LinkMessageID = result.LinkMessageID
+		entry.FileID = result.VideoNote.VideoNote.FileID
+		entry.MessageText = result.MessageText
+		entry.ParseMode = result.Destination.ParseMode
+		if err := appendHistory(historyPath, entry); err != nil {
+			slog.Warn("Failed to record history", "destination", result.Destination.Name, "err", err)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+// Values of -output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// event is one line of -output=json. Every event has a type and a time; which of the other
+// fields are set depends on the type:
+//
+//	status     job, url, status: the job moved to another stage
+//	resolved   job, url, title, artist, youtube_url, display
+//	progress   job, url, stage (download or encode), percent
+//	done       job, url, path: the clip is encoded
+//	manifest   url, path: make -o wrote the clip's manifest
+//	published  url, destination, chat_id, link_message_id, message_id, file_id
+//	scheduled  url, destinations, queue_job, publish_at, review: queued for the daemon or moderators
+//	error      stage, code, error, and job, url or destination when it concerns one
+type event struct {
+	Type          string         `json:"type"`
+	Time          time.Time      `json:"time"`
+	Job           string         `json:"job,omitempty"`
+	URL           string         `json:"url,omitempty"`
+	Status        string         `json:"status,omitempty"`
+	Stage         pipeline.Stage `json:"stage,omitempty"`
+	Percent       *float64       `json:"percent,omitempty"`
+	Title         string         `json:"title,omitempty"`
+	Artist        string         `json:"artist,omitempty"`
+	YoutubeURL    string         `json:"youtube_url,omitempty"`
+	Display       string         `json:"display,omitempty"`
+	Path          string         `json:"path,omitempty"`
+	Destination   string         `json:"destination,omitempty"`
+	Destinations  []string       `json:"destinations,omitempty"`
+	ChatID        string         `json:"chat_id,omitempty"`
+	LinkMessageID int            `json:"link_message_id,omitempty"`
+	MessageID     int            `json:"message_id,omitempty"`
+	FileID        string         `json:"file_id,omitempty"`
+	QueueJob      string         `json:"queue_job,omitempty"`
+	PublishAt     *time.Time     `json:"publish_at,omitempty"`
+	Review        bool           `json:"review,omitempty"`
+	Code          int            `json:"code,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// eventWriter writes events as newline-delimited JSON. Its methods do nothing on a nil
+// *eventWriter, which is what events is unless -output=json was given, so callers don't
+// need to check the output format.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// resolved holds the jobs a resolved event was written for.
+	resolved map[string]bool
+	// percent is the last whole percent reported for each job and stage, so yt-dlp's
+	// many progress updates don't turn into as many events.
+	percent map[string]int
+}
+
+var events *eventWriter
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{
+		enc:      json.NewEncoder(w),
+		resolved: make(map[string]bool),
+		percent:  make(map[string]int),
+	}
+}
+
+// startEvents switches to -output=json: events go to stdout, and whatever else would be
+// printed to stdout or stderr, including the output of yt-dlp and ffmpeg, is dropped.
+// The log, which is set up before and has the warnings and errors, stays on stderr.
+func startEvents() error {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	events = newEventWriter(os.Stdout)
+	os.Stdout, os.Stderr = devNull, devNull
+	return nil
+}
+
+func (w *eventWriter) emit(e event) {
+	if w == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.Error = logging.Redact(e.Error)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(e); err != nil {
+		slog.Warn("Failed to write event", "err", err)
+	}
+}
+
+// jobStatus reports a job's new stage. printJobStatus calls it for every OnStatus callback.
+func (w *eventWriter) jobStatus(job *pipeline.ClipJob) {
+	if w == nil {
+		return
+	}
+	status, err := job.Status()
+	w.emit(event{Type: "status", Job: job.ID, URL: job.Request.URL, Status: string(status)})
+
+	if clip := job.Clip(); clip != nil && status != pipeline.ClipFailed {
+		w.mu.Lock()
+		first := !w.resolved[job.ID]
+		w.resolved[job.ID] = true
+		w.mu.Unlock()
+		if first {
+			w.emit(event{
+				Type:       "resolved",
+				Job:        job.ID,
+				URL:        job.Request.URL,
+				Title:      clip.Track.Title,
+				Artist:     clip.Track.Artist,
+				YoutubeURL: clip.Track.YoutubeURL,
+				Display:    clip.Display,
+			})
+		}
+		if status == pipeline.ClipDone {
+			w.emit(event{Type: "done", Job: job.ID, URL: job.Request.URL, Path: clip.Path})
+		}
+	}
+	if status == pipeline.ClipFailed {
+		w.emit(event{
+			Type:  "error",
+			Job:   job.ID,
+			URL:   job.Request.URL,
+			Stage: pipeline.ErrorStage(err),
+			Code:  stageExitCode(err),
+			Error: err.Error(),
+		})
+	}
+}
+
+// jobProgress reports how far a job's download or encode has got. It is an OnProgress
+// callback.
+func (w *eventWriter) jobProgress(job *pipeline.ClipJob, fraction float64) {
+	if w == nil {
+		return
+	}
+	status, _ := job.Status()
+	stage := pipeline.StageDownload
+	if status == pipeline.ClipEncoding {
+		stage = pipeline.StageEncode
+	}
+	key := job.ID + "/" + string(stage)
+	whole := int(fraction * 100)
+	w.mu.Lock()
+	last, seen := w.percent[key]
+	w.percent[key] = whole
+	w.mu.Unlock()
+	if seen && last == whole {
+		return
+	}
+	percent := float64(whole)
+	w.emit(event{Type: "progress", Job: job.ID, URL: job.Request.URL, Stage: stage, Percent: &percent})
+}
+
+// watchJobs reports the pool's jobs on the command line, or as events with -output=json.
+func watchJobs(pool *pipeline.WorkerPool) {
+	pool.OnStatus = printJobStatus
+	if events != nil {
+		pool.OnProgress = events.jobProgress
+	}
+}
+
+// published reports the outcome of posting a clip to one destination.
+func (w *eventWriter) published(clip *pipeline.Clip, result pipeline.PublishResult) {
+	if w == nil {
+		return
+	}
+	if result.Err != nil {
+		w.failed(clip, result.Destination.Name, pipeline.StagePublish, exitPublish, result.Err.Error())
+		return
+	}
+	e := event{
+		Type:          "published",
+		URL:           clip.Request.URL,
+		Destination:   result.Destination.Name,
+		ChatID:        result.Destination.ChatID,
+		LinkMessageID: result.LinkMessageID,
+		MessageID:     result.VideoNote.MessageID,
+	}
+	if result.VideoNote.VideoNote != nil {
+		e.FileID = result.VideoNote.VideoNote.FileID
+	}
+	w.emit(e)
+}
+
+// scheduled reports a clip queued for the daemon, or sent to moderators if review is set.
+func (w *eventWriter) scheduled(clip *pipeline.Clip, job *ScheduledJob, review bool) {
+	if w == nil {
+		return
+	}
+	e := event{Type: "scheduled", URL: clip.Request.URL, QueueJob: job.ID, Review: review}
+	for _, d := range job.Destinations {
+		e.Destinations = append(e.Destinations, d.Name)
+	}
+	if !job.PublishAt.IsZero() {
+		e.PublishAt = &job.PublishAt
+	}
+	w.emit(e)
+}
+
+// failed reports an error about a clip, and the destination it concerns if there is one.
+func (w *eventWriter) failed(clip *pipeline.Clip, destination string, stage pipeline.Stage, code int, message string) {
+	w.emit(event{
+		Type:        "error",
+		URL:         clip.Request.URL,
+		Destination: destination,
+		Stage:       stage,
+		Code:        code,
+		Error:       message,
+	})
+}
+
+// codeStage is the stage an exit code stands for, or "" for the generic ones.
+func codeStage(code int) pipeline.Stage {
+	switch code {
+	case exitResolve:
+		return pipeline.StageResolve
+	case exitDownload:
+		return pipeline.StageDownload
+	case exitEncode:
+		return pipeline.StageEncode
+	case exitPublish:
+		return pipeline.StagePublish
+	}
+	return ""
+}
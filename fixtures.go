@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/resolve/resolvetest"
+)
+
+var fixturesCmd = &command{
+	name:    "fixtures",
+	args:    "[action] [flags]",
+	summary: "check or record the song.link fixtures",
+	about:   "Replays the recorded song.link responses.",
+	actions: []commandAction{
+		{"check", "[flags]", "replay every fixture"},
+		{"record", "[flags] [url]...", "fetch song.link responses for new URLs, or refresh all fixtures"},
+	},
+	defaultAction: "check",
+	setup:         setupFixtures,
+}
+
+// setupFixtures checks the recorded song.link fixtures. With "record" it refreshes them.
+func setupFixtures(fs *flag.FlagSet, common *commonFlags) func(string) {
+	dirFlag := fs.String("dir", resolvetest.DefaultDir, "Directory holding the song.link fixtures")
+	nameFlag := fs.String("name", "", "With record and a single URL: name of the fixture (default derived from the URL)")
+	updateFlag := fs.Bool("update", false, "With record: also replace the expected track details with the current result")
+
+	return func(action string) {
+		// The resolver's log is only interesting with -v.
+		if !common.verbose {
+			slog.SetDefault(slog.New(slog.DiscardHandler))
+		}
+
+		switch action {
+		case "check":
+			if !checkFixtures(*dirFlag) {
+				os.Exit(exitFailure)
+			}
+		case "record":
+			if *nameFlag != "" && fs.NArg() != 1 {
+				fmt.Fprintln(os.Stderr, "Error: -name needs exactly one URL")
+				os.Exit(exitUsage)
+			}
+			if !recordFixtures(*dirFlag, *nameFlag, fs.Args(), *updateFlag) {
+				os.Exit(exitFailure)
+			}
+		}
+	}
+}
+
+func checkFixtures(dir string) bool {
+	fixtures, err := resolvetest.Load(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load fixtures: %v\n", err)
+		return false
+	}
+	if len(fixtures) == 0 {
+		fmt.Printf("No fixtures in %s.\n", dir)
+		return true
+	}
+
+	failed := 0
+	for _, fixture := range fixtures {
+		diffs, err := fixture.Check()
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("❌ %s: %v\n", fixture.Name, err)
+		case len(diffs) > 0:
+			failed++
+			fmt.Printf("❌ %s (%s)\n", fixture.Name, fixture.URL)
+			for _, diff := range diffs {
+				fmt.Printf("     %s\n", diff)
+			}
+		default:
+			fmt.Printf("✅ %s\n", fixture.Name)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d fixtures failed\n", failed, len(fixtures))
+		return false
+	}
+	fmt.Printf("\nAll %d fixtures passed\n", len(fixtures))
+	return true
+}
+
+// recordFixtures records new fixtures for urls, or refreshes every existing fixture when
+// urls is empty. New fixtures expect whatever the resolver returns today, so check them
+// by hand; existing ones keep their expected details unless update is set.
+func recordFixtures(dir, name string, urls []string, update bool) bool {
+	var fixtures []*resolvetest.Fixture
+	isNew := make(map[*resolvetest.Fixture]bool)
+	if len(urls) == 0 {
+		existing, err := resolvetest.Load(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to load fixtures: %v\n", err)
+			return false
+		}
+		fixtures = existing
+	}
+	for _, songURL := range urls {
+		fixtureName := name
+		if fixtureName == "" {
+			fixtureName = fixtureNameFor(songURL)
+		}
+		fixtureDir := filepath.Join(dir, fixtureName)
+		fixture, err := resolvetest.LoadFixture(fixtureDir)
+		if err != nil {
+			fixture = &resolvetest.Fixture{Name: fixtureName, Dir: fixtureDir, URL: songURL}
+			isNew[fixture] = true
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	ok := true
+	for _, fixture := range fixtures {
+		if err := fixture.Record(client); err != nil {
+			ok = false
+			fmt.Printf("❌ %s: %v\n", fixture.Name, err)
+			continue
+		}
+		track, err := fixture.Resolve()
+		if err != nil {
+			ok = false
+			fmt.Printf("❌ %s: %v\n", fixture.Name, err)
+			continue
+		}
+		if update || isNew[fixture] || fixture.Expected == track {
+			fixture.Expected = track
+			if err := fixture.Save(); err != nil {
+				ok = false
+				fmt.Printf("❌ %s: %v\n", fixture.Name, err)
+				continue
+			}
+			fmt.Printf("✅ %s: title %q, artist %q, YouTube %q\n", fixture.Name, track.Title, track.Artist, track.YoutubeURL)
+		} else {
+			fmt.Printf("⚠️ %s: recorded, but the result changed to title %q, artist %q, YouTube %q. Run with -update if that is right.\n", fixture.Name, track.Title, track.Artist, track.YoutubeURL)
+		}
+	}
+	return ok
+}
+
+var fixtureNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// fixtureNameFor names a fixture after the song link, e.g. "song.link/s/3Kz" becomes "s-3Kz".
+func fixtureNameFor(songURL string) string {
+	name := songURL
+	if u, err := url.Parse(songURL); err == nil && u.Path != "" && u.Path != "/" {
+		name = strings.Trim(path.Clean(u.Path), "/")
+	}
+	return strings.Trim(fixtureNameInvalidChars.ReplaceAllString(name, "-"), "-")
+}
@@ -1,8 +1,8 @@
-module main.go
+module github.com/Ma11doror/tgCircleGen
 
 go 1.24.2
 
 require (
 	golang.org/x/net v0.40.0
-	golang.org/x/text v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+)
+
+const defaultHistoryPath = "history.jsonl"
+
+// HistoryEntry is a single published video note, stored one JSON object per line.
+type HistoryEntry struct {
+	PostedAt    time.Time `json:"posted_at"`
+	SourceURL   string    `json:"source_url"`
+	YoutubeURL  string    `json:"youtube_url,omitempty"`
+	YoutubeID   string    `json:"youtube_id,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Artist      string    `json:"artist,omitempty"`
+	Start       int       `json:"start"`
+	Duration    int       `json:"duration"`
+	Destination string    `json:"destination,omitempty"`
+	ChatID      string    `json:"chat_id"`
+	MessageID   int       `json:"message_id"`
+	// LinkMessageID is the text message posted right before the video note.
+	LinkMessageID int    `json:"link_message_id,omitempty"`
+	FileID        string `json:"file_id"`
+	MessageText   string `json:"message_text,omitempty"`
+	ParseMode     string `json:"parse_mode,omitempty"`
+	// Status is empty for published posts and "rejected" for clips a moderator turned down.
+	Status       string `json:"status,omitempty"`
+	RejectReason string `json:"reject_reason,omitempty"`
+	ReviewedBy   string `json:"reviewed_by,omitempty"`
+}
+
+const HistoryRejected = "rejected"
+
+func (e HistoryEntry) Published() bool {
+	return e.Status == ""
+}
+
+func appendHistory(path string, entry HistoryEntry) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("failed to write history file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadHistory returns all entries in the order they were posted.
+// A missing history file is not an error and yields no entries.
+func loadHistory(path string) ([]HistoryEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode history file %s line %d: %w", path, lineNo, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// findHistoryByFileID returns the most recent published entry with the given file_id.
+func findHistoryByFileID(entries []HistoryEntry, fileID string) (HistoryEntry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Published() && entries[i].FileID == fileID {
+			return entries[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// approvedByModerator reports whether a moderator approved the video note with the given
+// file_id: it was published after review and never rejected.
+func approvedByModerator(entries []HistoryEntry, fileID string) bool {
+	approved := false
+	for _, entry := range entries {
+		if entry.FileID != fileID {
+			continue
+		}
+		if entry.Status == HistoryRejected {
+			return false
+		}
+		if entry.Published() && entry.ReviewedBy != "" {
+			approved = true
+		}
+	}
+	return approved
+}
+
+// youtubeVideoID extracts the video ID from youtube.com, music.youtube.com and youtu.be URLs.
+func youtubeVideoID(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	switch {
+	case host == "youtu.be":
+		return strings.Trim(u.Path, "/")
+	case host == "youtube.com" || strings.HasSuffix(host, ".youtube.com"):
+		if id := u.Query().Get("v"); id != "" {
+			return id
+		}
+		for _, prefix := range []string{"/embed/", "/shorts/", "/live/"} {
+			if id, ok := strings.CutPrefix(u.Path, prefix); ok {
+				return strings.Trim(id, "/")
+			}
+		}
+	}
+	return ""
+}
+
+// sameTrack reports whether two entries are the same song: the same YouTube video, the same
+// source link, or the same title and artist.
+func sameTrack(a, b HistoryEntry) bool {
+	if a.YoutubeID != "" && a.YoutubeID == b.YoutubeID {
+		return true
+	}
+	if a.SourceURL != "" && a.SourceURL == b.SourceURL {
+		return true
+	}
+	return a.Title != "" && a.Artist != "" &&
+		strings.EqualFold(a.Title, b.Title) && strings.EqualFold(a.Artist, b.Artist)
+}
+
+// findRecentDuplicate returns the latest published entry of the same track in chatID that
+// was posted within window before now.
+func findRecentDuplicate(entries []HistoryEntry, track HistoryEntry, chatID string, window time.Duration, now time.Time) (HistoryEntry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if now.Sub(entry.PostedAt) > window {
+			continue
+		}
+		if entry.Published() && entry.ChatID == chatID && sameTrack(track, entry) {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// filterDuplicates drops the destinations the track was already posted to within the
+// configured window and prints a warning for each. With force, it only warns.
+func filterDuplicates(cfg *config.Config, historyPath string, track HistoryEntry, destinations []config.Destination, force bool) (allowed, refused []config.Destination) {
+	// loadConfig has already rejected invalid windows.
+	window, _ := config.ParseDuplicateWindow(cfg.DuplicateWindow)
+	if window == 0 {
+		return destinations, nil
+	}
+	entries, err := loadHistory(historyPath)
+	if err != nil {
+		slog.Warn("Failed to load history, skipping duplicate check", "err", err)
+		return destinations, nil
+	}
+
+	now := time.Now()
+	for _, d := range destinations {
+		previous, found := findRecentDuplicate(entries, track, d.ChatID, window, now)
+		if !found {
+			allowed = append(allowed, d)
+			continue
+		}
+		ago := now.Sub(previous.PostedAt).Round(time.Hour)
+		if force {
+			fmt.Printf("⚠️ Warning: %s was already posted to %s on %s (%s ago); posting anyway because of -force.\n", describeTrack(track), d.Name, previous.PostedAt.Format("2006-01-02 15:04"), ago)
+			allowed = append(allowed, d)
+			continue
+		}
+		fmt.Printf("⚠️ Warning: %s was already posted to %s on %s (%s ago); skipping it. Use -force to post anyway.\n", describeTrack(track), d.Name, previous.PostedAt.Format("2006-01-02 15:04"), ago)
+		refused = append(refused, d)
+	}
+	return allowed, refused
+}
+
+func describeTrack(entry HistoryEntry) string {
+	switch {
+	case entry.Title != "" && entry.Artist != "":
+		return fmt.Sprintf("%q by %s", entry.Title, entry.Artist)
+	case entry.Title != "":
+		return strconv.Quote(entry.Title)
+	default:
+		return entry.SourceURL
+	}
+}
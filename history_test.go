@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApprovedByModerator(t *testing.T) {
+	entries := []HistoryEntry{
+		{FileID: "direct", Destination: "group"},
+		{FileID: "approved", Destination: "main", ReviewedBy: "@mod"},
+		{FileID: "rejected", ChatID: "-100", Status: HistoryRejected, ReviewedBy: "@mod"},
+		{FileID: "both", Destination: "main", ReviewedBy: "@mod"},
+		{FileID: "both", ChatID: "-100", Status: HistoryRejected, ReviewedBy: "@other"},
+	}
+	tests := []struct {
+		fileID string
+		want   bool
+	}{
+		{"approved", true},
+		{"direct", false},
+		{"rejected", false},
+		{"both", false},
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		if got := approvedByModerator(entries, tt.fileID); got != tt.want {
+			t.Errorf("approvedByModerator(%q) = %v, want %v", tt.fileID, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	prog := programName()
+	tests := []struct {
+		entry HistoryEntry
+		want  string
+	}{
+		{HistoryEntry{SourceURL: "https://song.link/s/1", Start: 60, Duration: 30, Destination: "main"},
+			prog + " make -url https://song.link/s/1 -start 60 -duration 30"},
+		{HistoryEntry{SourceURL: "https://song.link/s/1", Start: 0, Duration: 15, Destination: "test"},
+			prog + " make -url https://song.link/s/1 -start 0 -duration 15 -t"},
+		{HistoryEntry{SourceURL: "https://song.link/s/1", Start: 5, Duration: 20, Title: "Don't Stop", Artist: "The Band", Destination: "group"},
+			prog + ` make -url https://song.link/s/1 -start 5 -duration 20 -songname 'Don'\''t Stop' -authorname 'The Band' -to group`},
+	}
+	for _, tt := range tests {
+		if got := historyCommand(tt.entry); got != tt.want {
+			t.Errorf("historyCommand(%+v) =\n%s\nwant\n%s", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestShowHistoryEntryCommands(t *testing.T) {
+	entry := HistoryEntry{SourceURL: "https://song.link/s/1", Start: 60, Duration: 30, FileID: "note-1"}
+	var sb strings.Builder
+	showHistoryEntry(&sb, historyRecord{ID: 1, HistoryEntry: entry})
+	want := "To make it again:\n  " + programName() + " make -url https://song.link/s/1 -start 60 -duration 30\n" +
+		"To repost it without re-encoding:\n  " + programName() + " repost -file-id note-1\n"
+	if !strings.HasSuffix(sb.String(), want) {
+		t.Errorf("showHistoryEntry ends with:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
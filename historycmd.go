@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+// historyRecord is a history entry together with its 1-based position in the history
+// file, which serves as a stable ID since the file is only ever appended to.
+type historyRecord struct {
+	ID int `json:"id"`
+	HistoryEntry
+}
+
+// historyFilter selects history entries; empty fields match everything.
+type historyFilter struct {
+	Artist      string
+	Title       string
+	Chat        string
+	Since       time.Time
+	Until       time.Time
+	Words       []string
+	AllStatuses bool
+}
+
+func (f historyFilter) match(entry HistoryEntry) bool {
+	if !f.AllStatuses && !entry.Published() {
+		return false
+	}
+	if f.Artist != "" && !containsFold(entry.Artist, f.Artist) {
+		return false
+	}
+	if f.Title != "" && !containsFold(entry.Title, f.Title) {
+		return false
+	}
+	if f.Chat != "" && entry.ChatID != f.Chat && entry.Destination != f.Chat {
+		return false
+	}
+	if !f.Since.IsZero() && entry.PostedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.PostedAt.Before(f.Until) {
+		return false
+	}
+	haystack := entry.Title + " " + entry.Artist + " " + entry.SourceURL
+	for _, word := range f.Words {
+		if !containsFold(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// parseHistoryDate accepts "2006-01-02", "2006-01-02 15:04" or RFC 3339, in local time.
+func parseHistoryDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD, \"YYYY-MM-DD HH:MM\" or RFC 3339", value)
+}
+
+var historyCmd = &command{
+	name:    "history",
+	args:    "[action] [flags]",
+	summary: "browse, search and export what has been posted",
+	about:   "Shows the local history of posted video notes.",
+	actions: []commandAction{
+		{"list", "[flags]", "show the newest posts"},
+		{"search", "[flags] <words>", "show posts whose title, artist or link contain every word"},
+		{"show", "<id>...", "show every detail of posts and the command to make them again"},
+		{"export", "[flags]", "write all matching posts as CSV or JSON"},
+	},
+	defaultAction: "list",
+	setup:         setupHistory,
+}
+
+func setupHistory(fs *flag.FlagSet, _ *commonFlags) func(string) {
+	historyFlag := fs.String("history", defaultHistoryPath, "Path to the local history of posted video notes")
+	artistFlag := fs.String("artist", "", "Only entries whose artist contains this text")
+	titleFlag := fs.String("title", "", "Only entries whose title contains this text")
+	chatFlag := fs.String("chat", "", "Only entries posted to this chat ID or destination name")
+	sinceFlag := fs.String("since", "", "Only entries posted at or after this date")
+	untilFlag := fs.String("until", "", "Only entries posted before this date")
+	allFlag := fs.Bool("all", false, "Also include clips rejected by moderators")
+	limitFlag := fs.Int("limit", 20, "With list and search: show at most this many of the newest entries (0 for all)")
+	formatFlag := fs.String("format", "", "Output format: table, json or csv (default table; csv for export)")
+	outputFlag := fs.String("o", "", "With export: write to this file instead of standard output")
+
+	return func(action string) {
+		filter := historyFilter{
+			Artist:      *artistFlag,
+			Title:       *titleFlag,
+			Chat:        *chatFlag,
+			AllStatuses: *allFlag,
+		}
+		var err error
+		if *sinceFlag != "" {
+			if filter.Since, err = parseHistoryDate(*sinceFlag); err != nil {
+				fatal(exitUsage, "Invalid -since", "err", err)
+			}
+		}
+		if *untilFlag != "" {
+			if filter.Until, err = parseHistoryDate(*untilFlag); err != nil {
+				fatal(exitUsage, "Invalid -until", "err", err)
+			}
+		}
+
+		entries, err := loadHistory(*historyFlag)
+		if err != nil {
+			fatal(exitFailure, "Failed to load history", "err", err)
+		}
+
+		format := *formatFlag
+		switch action {
+		case "list", "search":
+			if action == "search" {
+				if fs.NArg() == 0 {
+					slog.Error("search requires at least one word")
+					fs.Usage()
+					os.Exit(exitUsage)
+				}
+				filter.Words = fs.Args()
+			}
+			records := filterHistory(entries, filter)
+			if *limitFlag > 0 && len(records) > *limitFlag {
+				records = records[len(records)-*limitFlag:]
+			}
+			if format == "" {
+				format = "table"
+			}
+			if err := writeHistory(os.Stdout, records, format); err != nil {
+				fatal(exitFailure, "Failed to write history", "err", err)
+			}
+		case "export":
+			records := filterHistory(entries, filter)
+			if format == "" {
+				format = "csv"
+			}
+			out := io.Writer(os.Stdout)
+			if *outputFlag != "" {
+				file, err := os.Create(*outputFlag)
+				if err != nil {
+					fatal(exitFailure, "Failed to create export file", "err", err)
+				}
+				defer file.Close()
+				out = file
+			}
+			if err := writeHistory(out, records, format); err != nil {
+				fatal(exitFailure, "Failed to export history", "err", err)
+			}
+			if *outputFlag != "" {
+				fmt.Printf("✅ Exported %d entries to %s\n", len(records), *outputFlag)
+			}
+		case "show":
+			if fs.NArg() == 0 {
+				slog.Error("show requires at least one entry ID")
+				fs.Usage()
+				os.Exit(exitUsage)
+			}
+			for i, arg := range fs.Args() {
+				id, err := strconv.Atoi(arg)
+				if err != nil || id < 1 || id > len(entries) {
+					fatal(exitUsage, fmt.Sprintf("No history entry %q; IDs run from 1 to %d", arg, len(entries)))
+				}
+				if i > 0 {
+					fmt.Println()
+				}
+				showHistoryEntry(os.Stdout, historyRecord{ID: id, HistoryEntry: entries[id-1]})
+			}
+		}
+	}
+}
+
+// filterHistory returns the matching entries in the order they were posted.
+func filterHistory(entries []HistoryEntry, filter historyFilter) []historyRecord {
+	var records []historyRecord
+	for i, entry := range entries {
+		if filter.match(entry) {
+			records = append(records, historyRecord{ID: i + 1, HistoryEntry: entry})
+		}
+	}
+	return records
+}
+
+var historyCSVHeader = []string{
+	"id", "posted_at", "status", "title", "artist", "source_url", "youtube_url", "youtube_id",
+	"start", "duration", "destination", "chat_id", "link_message_id", "message_id", "file_id",
+	"reject_reason", "reviewed_by",
+}
+
+func writeHistory(w io.Writer, records []historyRecord, format string) error {
+	switch format {
+	case "table":
+		if len(records) == 0 {
+			fmt.Fprintln(w, "No matching history entries.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPOSTED AT\tCHAT\tCLIP\tTRACK")
+		for _, r := range records {
+			chat := r.Destination
+			if chat == "" {
+				chat = r.ChatID
+			}
+			if !r.Published() {
+				chat += " (" + r.Status + ")"
+			}
+			clip := fmt.Sprintf("%s +%ds", pipeline.FormatDuration(r.Start), r.Duration)
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", r.ID, r.PostedAt.Local().Format("2006-01-02 15:04"), chat, clip, describeTrack(r.HistoryEntry))
+		}
+		return tw.Flush()
+	case "json":
+		if records == nil {
+			records = []historyRecord{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(historyCSVHeader)
+		for _, r := range records {
+			status := r.Status
+			if status == "" {
+				status = "published"
+			}
+			cw.Write([]string{
+				strconv.Itoa(r.ID), r.PostedAt.Format(time.RFC3339), status, r.Title, r.Artist,
+				r.SourceURL, r.YoutubeURL, r.YoutubeID, strconv.Itoa(r.Start), strconv.Itoa(r.Duration),
+				r.Destination, r.ChatID, strconv.Itoa(r.LinkMessageID), strconv.Itoa(r.MessageID), r.FileID,
+				r.RejectReason, r.ReviewedBy,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format %q, use table, json or csv", format)
+	}
+}
+
+func showHistoryEntry(w io.Writer, r historyRecord) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", name, value)
+		}
+	}
+	status := r.Status
+	if status == "" {
+		status = "published"
+	}
+	field("ID", strconv.Itoa(r.ID))
+	field("Posted at", r.PostedAt.Local().Format("2006-01-02 15:04:05"))
+	field("Status", status)
+	field("Title", r.Title)
+	field("Artist", r.Artist)
+	field("Song link", r.SourceURL)
+	field("YouTube", r.YoutubeURL)
+	field("Clip", fmt.Sprintf("%s from %s", pipeline.FormatDuration(r.Duration), pipeline.FormatDuration(r.Start)))
+	field("Destination", r.Destination)
+	field("Chat", r.ChatID)
+	if r.LinkMessageID != 0 {
+		field("Link message", strconv.Itoa(r.LinkMessageID))
+	}
+	if r.MessageID != 0 {
+		field("Video note", strconv.Itoa(r.MessageID))
+	}
+	field("File ID", r.FileID)
+	field("Reviewed by", r.ReviewedBy)
+	field("Reject reason", r.RejectReason)
+	field("Message", r.MessageText)
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nTo make it again:\n  %s\n", historyCommand(r.HistoryEntry))
+	if r.FileID != "" && r.Published() {
+		fmt.Fprintf(w, "To repost it without re-encoding:\n  %s\n", shellJoin([]string{programName(), "repost", "-file-id", r.FileID}))
+	}
+}
+
+// historyCommand rebuilds the command line that makes the same clip for the same destination.
+func historyCommand(entry HistoryEntry) string {
+	args := []string{programName(), "make",
+		"-url", entry.SourceURL,
+		"-start", strconv.Itoa(entry.Start),
+		"-duration", strconv.Itoa(entry.Duration),
+	}
+	if entry.Title != "" && entry.Artist != "" {
+		args = append(args, "-songname", entry.Title, "-authorname", entry.Artist)
+	}
+	switch entry.Destination {
+	case "", "main":
+	case "test":
+		args = append(args, "-t")
+	default:
+		args = append(args, "-to", entry.Destination)
+	}
+	return shellJoin(args)
+}
+
+// shellJoin quotes args for a POSIX shell where needed.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+// initAllowedUpdates are the updates that reveal chats the bot was added to or written in.
+const initAllowedUpdates = `["message","channel_post","my_chat_member"]`
+
+var initCmd = &command{
+	name:    "init",
+	args:    "[flags]",
+	summary: "write config.json step by step",
+	about:   "Creates a config file step by step: checks the bot token and finds the chats the bot was added to.",
+	setup:   setupInit,
+}
+
+// setupInit asks for the bot token and the chats to post to, and writes config.json.
+func setupInit(fs *flag.FlagSet, _ *commonFlags) func(string) {
+	outputFlag := fs.String("o", config.FileName, "Where to write the config")
+	forceFlag := fs.Bool("force", false, "Overwrite an existing config file")
+	apiURLFlag := fs.String("api-url", "", "Bot API server to use instead of the official one")
+
+	return func(string) {
+		if _, err := os.Stat(*outputFlag); err == nil && !*forceFlag {
+			fatal(exitUsage, "Config already exists; use -force to replace it or -o to write elsewhere", "path", *outputFlag)
+		}
+
+		in := bufio.NewReader(os.Stdin)
+		ctx := context.Background()
+
+		fmt.Println("1. Create a bot with @BotFather (/newbot) and paste the token it gives you.")
+		var tg *telegram.Client
+		var me *telegram.User
+		for me == nil {
+			token, err := prompt(in, "Bot token: ")
+			if err != nil {
+				fatal(exitFailure, "Failed to read input", "err", err)
+			}
+			if token == "" {
+				continue
+			}
+			tg = telegram.NewClient(token)
+			tg.BaseURL = *apiURLFlag
+			if me, err = tg.GetMe(ctx); err != nil {
+				fmt.Printf("❌ Telegram did not accept the token: %v\n", err)
+			}
+		}
+		fmt.Printf("✅ Token belongs to @%s (%s)\n\n", me.Username, me.FirstName)
+
+		fmt.Printf("2. Add @%s as an administrator to your channel (and test channel), then post any message there.\n", me.Username)
+		fmt.Println("   For a group, add the bot and send a message in the group. Press Enter when done.")
+		var chats []telegram.Chat
+		for {
+			if _, err := prompt(in, ""); err != nil {
+				fatal(exitFailure, "Failed to read input", "err", err)
+			}
+			found, err := discoverChats(ctx, tg)
+			if err != nil {
+				fatal(exitFailure, "Failed to find chats", "err", err)
+			}
+			chats = mergeChats(chats, found)
+			if len(chats) > 0 {
+				break
+			}
+			fmt.Println("⏳ No chats seen yet. Post a message in the channel and press Enter to look again.")
+		}
+
+		rescan := func() {
+			found, err := discoverChats(ctx, tg)
+			if err != nil {
+				fatal(exitFailure, "Failed to find chats", "err", err)
+			}
+			chats = mergeChats(chats, found)
+		}
+		listChats := func() {
+			fmt.Println("\nChats the bot has seen:")
+			for i, chat := range chats {
+				fmt.Printf("  %d. %s\n", i+1, describeChat(chat))
+			}
+			fmt.Println("  r. look for more chats")
+		}
+
+		fmt.Println("\n3. Pick the chats to post to.")
+		var mainChat, testChat *telegram.Chat
+		for mainChat == nil {
+			listChats()
+			chat, err := pickChat(in, "Main channel", chats, false)
+			if errors.Is(err, errRescan) {
+				rescan()
+				continue
+			}
+			if err != nil {
+				fatal(exitFailure, "Failed to read input", "err", err)
+			}
+			mainChat = chat
+		}
+		for {
+			chat, err := pickChat(in, "Test channel (Enter to skip)", chats, true)
+			if errors.Is(err, errRescan) {
+				rescan()
+				listChats()
+				continue
+			}
+			if err != nil {
+				fatal(exitFailure, "Failed to read input", "err", err)
+			}
+			testChat = chat
+			break
+		}
+
+		// Only the fields asked for are written, so the file stays short enough to edit by hand.
+		cfg := struct {
+			BotToken   string `json:"bot_token"`
+			APIURL     string `json:"api_url,omitempty"`
+			ChatID     string `json:"chat_id"`
+			ChatIDTest string `json:"chat_id_test,omitempty"`
+		}{
+			BotToken: tg.Token,
+			APIURL:   *apiURLFlag,
+			ChatID:   chatRef(*mainChat),
+		}
+		if testChat != nil {
+			cfg.ChatIDTest = chatRef(*testChat)
+		}
+		if err := writeConfig(*outputFlag, cfg); err != nil {
+			fatal(exitFailure, "Failed to write config", "err", err)
+		}
+		if _, err := config.Load(*outputFlag); err != nil {
+			fatal(exitFailure, "The written config does not load", "err", err)
+		}
+		fmt.Printf("\n✅ Wrote %s, readable only by you. Check it any time with:\n", *outputFlag)
+		fmt.Printf("  %s\n", shellJoin([]string{programName(), "config", "validate", "-config", *outputFlag}))
+	}
+}
+
+var errRescan = errors.New("rescan")
+
+func prompt(in *bufio.Reader, question string) (string, error) {
+	fmt.Print(question)
+	line, err := in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// pickChat asks for a chat by its number in the list. It returns nil for an empty answer
+// if optional is set, and errRescan for "r".
+func pickChat(in *bufio.Reader, label string, chats []telegram.Chat, optional bool) (*telegram.Chat, error) {
+	for {
+		answer, err := prompt(in, label+": ")
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case answer == "" && optional:
+			return nil, nil
+		case strings.EqualFold(answer, "r"):
+			return nil, errRescan
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(chats) {
+			fmt.Printf("Please enter a number from 1 to %d, or r.\n", len(chats))
+			continue
+		}
+		return &chats[n-1], nil
+	}
+}
+
+// discoverChats reads pending updates without confirming them and returns the chats they
+// come from, in the order they were first seen.
+func discoverChats(ctx context.Context, tg *telegram.Client) ([]telegram.Chat, error) {
+	params := url.Values{}
+	params.Add("timeout", "5")
+	params.Add("allowed_updates", initAllowedUpdates)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var updates []telegram.Update
+	if err := tg.Call(ctx, "getUpdates", params, &updates); err != nil {
+		if strings.Contains(err.Error(), "409") {
+			return nil, fmt.Errorf("the bot has a webhook set or is running elsewhere; stop it first: %w", err)
+		}
+		return nil, err
+	}
+
+	var chats []telegram.Chat
+	for _, u := range updates {
+		switch {
+		case u.ChannelPost != nil:
+			chats = mergeChats(chats, []telegram.Chat{u.ChannelPost.Chat})
+		case u.Message != nil:
+			chats = mergeChats(chats, []telegram.Chat{u.Message.Chat})
+		case u.MyChatMember != nil:
+			chats = mergeChats(chats, []telegram.Chat{u.MyChatMember.Chat})
+		}
+	}
+	return chats, nil
+}
+
+// mergeChats appends the chats from found that are not in chats yet.
+func mergeChats(chats, found []telegram.Chat) []telegram.Chat {
+	for _, chat := range found {
+		seen := false
+		for _, c := range chats {
+			if c.ID == chat.ID {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			chats = append(chats, chat)
+		}
+	}
+	return chats
+}
+
+func describeChat(chat telegram.Chat) string {
+	name := chat.Title
+	if name == "" {
+		name = "(private chat)"
+	}
+	if chat.Username != "" {
+		name += " @" + chat.Username
+	}
+	return fmt.Sprintf("%s — %s, ID %d", name, chat.Type, chat.ID)
+}
+
+// chatRef is how config.json refers to a chat: its public @username if it has one, since
+// that is easier to recognise, or else its numeric ID.
+func chatRef(chat telegram.Chat) string {
+	if chat.Username != "" && chat.Type == "channel" {
+		return "@" + chat.Username
+	}
+	return strconv.FormatInt(chat.ID, 10)
+}
+
+// writeConfig writes cfg as JSON readable and writable only by the current user, since it
+// holds the bot token.
+func writeConfig(path string, cfg any) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// OpenFile keeps the mode of an existing file.
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+const inlinePageSize = 20
+
+// searchHistory returns one entry per posted video note, newest first, whose title or artist
+// contains every word of query. An empty query matches everything.
+func searchHistory(entries []HistoryEntry, query string) []HistoryEntry {
+	words := strings.Fields(strings.ToLower(query))
+	seen := make(map[string]bool)
+	var matches []HistoryEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if !entry.Published() || entry.FileID == "" || seen[entry.FileID] {
+			continue
+		}
+		haystack := strings.ToLower(entry.Title + " " + entry.Artist)
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(haystack, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			seen[entry.FileID] = true
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+// inlineResult offers a posted circle as a cached video. There is no inline result type
+// for video notes, so this relies on Telegram accepting a video note's file_id as a video,
+// which it may refuse; handleInlineQuery tells the user when it does.
+func inlineResult(entry HistoryEntry) telegram.InlineQueryResultCachedVideo {
+	title := entry.Title
+	if title == "" {
+		title = entry.SourceURL
+	}
+	description := entry.Artist
+	if description != "" {
+		description += " · "
+	}
+	description += fmt.Sprintf("%s from %s", pipeline.FormatDuration(entry.Duration), pipeline.FormatDuration(entry.Start))
+
+	// Result IDs are limited to 64 bytes; the tail of a file_id is unique enough.
+	id := entry.FileID
+	if len(id) > 64 {
+		id = id[len(id)-64:]
+	}
+	return telegram.InlineQueryResultCachedVideo{
+		Type:        "video",
+		ID:          id,
+		VideoFileID: entry.FileID,
+		Title:       title,
+		Description: description,
+	}
+}
+
+// inlineFailedStart is the /start parameter of the button shown when Telegram refused the
+// inline results.
+const inlineFailedStart = "inline_failed"
+
+const inlineFailedText = "Telegram refused to show these circles inline. Open the channel to forward them instead."
+
+func (b *Bot) handleInlineQuery(query *telegram.InlineQuery) {
+	if !b.cfg.Bot.InlineForEveryone && !b.isAllowed(&query.From) {
+		if err := b.answerInlineQuery(query.ID, nil, "", nil); err != nil {
+			slog.Warn("Failed to answer inline query", "err", err)
+		}
+		return
+	}
+
+	entries, err := loadHistory(b.historyPath)
+	if err != nil {
+		slog.Warn("Failed to load history for inline query", "err", err)
+		if err := b.answerInlineQuery(query.ID, nil, "", nil); err != nil {
+			slog.Warn("Failed to answer inline query", "err", err)
+		}
+		return
+	}
+	matches := searchHistory(entries, query.Query)
+
+	offset, _ := strconv.Atoi(query.Offset)
+	if offset < 0 || offset > len(matches) {
+		offset = len(matches)
+	}
+	end := min(offset+inlinePageSize, len(matches))
+
+	results := make([]telegram.InlineQueryResultCachedVideo, 0, end-offset)
+	for _, entry := range matches[offset:end] {
+		results = append(results, inlineResult(entry))
+	}
+	nextOffset := ""
+	if end < len(matches) {
+		nextOffset = strconv.Itoa(end)
+	}
+	if err := b.answerInlineQuery(query.ID, results, nextOffset, nil); err != nil {
+		// Most likely Telegram refused a video note's file_id as a cached video. Without
+		// an answer the user sees nothing at all, so answer again with an explanation.
+		slog.Error("Telegram refused the inline results", "query", query.Query, "results", len(results), "err", err)
+		button := &telegram.InlineQueryResultsButton{Text: "⚠️ Circles can't be shown inline", StartParameter: inlineFailedStart}
+		if err := b.answerInlineQuery(query.ID, nil, "", button); err != nil {
+			slog.Warn("Failed to answer inline query", "err", err)
+		}
+	}
+}
+
+// answerInlineQuery sends results, and button above them if it is set.
+func (b *Bot) answerInlineQuery(queryID string, results []telegram.InlineQueryResultCachedVideo, nextOffset string, button *telegram.InlineQueryResultsButton) error {
+	if results == nil {
+		results = []telegram.InlineQueryResultCachedVideo{}
+	}
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to encode inline results: %w", err)
+	}
+
+	params := url.Values{}
+	params.Add("inline_query_id", queryID)
+	params.Add("results", string(encoded))
+	params.Add("cache_time", "30")
+	if nextOffset != "" {
+		params.Add("next_offset", nextOffset)
+	}
+	if button != nil {
+		encoded, err := json.Marshal(button)
+		if err != nil {
+			return fmt.Errorf("failed to encode inline button: %w", err)
+		}
+		params.Add("button", string(encoded))
+	}
+	return b.tg.Call(context.Background(), "answerInlineQuery", params, nil)
+}
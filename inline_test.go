@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+func TestSearchHistory(t *testing.T) {
+	entries := []HistoryEntry{
+		{Title: "Song One", Artist: "Band", FileID: "a"},
+		{Title: "Other", Artist: "Singer", FileID: "b"},
+		{Title: "Song One", Artist: "Band", FileID: "a"},
+		{Title: "Song Two", Artist: "Band", FileID: "c", Status: HistoryRejected},
+		{Title: "Song Three", Artist: "Band", FileID: ""},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"a", "b"}},
+		{"band", []string{"a"}},
+		{"SONG band", []string{"a"}},
+		{"singer other", []string{"b"}},
+		{"two", nil},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, entry := range searchHistory(entries, tt.query) {
+			got = append(got, entry.FileID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("searchHistory(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func inlineQuery(query, offset string) telegram.Update {
+	return telegram.Update{UpdateID: 1, InlineQuery: &telegram.InlineQuery{
+		ID:     "q1",
+		From:   telegram.User{ID: testUserID, FirstName: "Test"},
+		Query:  query,
+		Offset: offset,
+	}}
+}
+
+func TestInlineQueryPages(t *testing.T) {
+	bot, srv := newTestBot(t)
+	for i := range inlinePageSize + 5 {
+		if err := appendHistory(bot.historyPath, HistoryEntry{Title: fmt.Sprintf("Song %d", i), Artist: "Band", Duration: 30, FileID: fmt.Sprintf("video-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bot.handleUpdate(inlineQuery("band", ""))
+	bot.handleUpdate(inlineQuery("band", "20"))
+
+	answers := srv.Requests("answerInlineQuery")
+	if len(answers) != 2 {
+		t.Fatalf("got %d answers, want 2", len(answers))
+	}
+	for i, want := range []struct {
+		results int
+		next    string
+	}{{inlinePageSize, "20"}, {5, ""}} {
+		if answers[i].Err != "" {
+			t.Fatalf("page %d failed: %s", i, answers[i].Err)
+		}
+		p := answers[i].Params
+		var results []telegram.InlineQueryResultCachedVideo
+		if err := json.Unmarshal([]byte(p.Get("results")), &results); err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != want.results || p.Get("next_offset") != want.next {
+			t.Errorf("page %d: %d results, next_offset %q; want %d, %q", i, len(results), p.Get("next_offset"), want.results, want.next)
+		}
+	}
+}
+
+func TestInlineQueryRefused(t *testing.T) {
+	bot, srv := newTestBot(t)
+	// The fake server, like Telegram, refuses a video note's file_id as a cached video.
+	if err := appendHistory(bot.historyPath, HistoryEntry{Title: "Song", Artist: "Band", Duration: 30, FileID: "fake-video-note-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bot.handleUpdate(inlineQuery("song", ""))
+
+	answers := srv.Requests("answerInlineQuery")
+	if len(answers) != 2 {
+		t.Fatalf("got %d answers, want the refused one and an explanation", len(answers))
+	}
+	if answers[0].Err == "" {
+		t.Error("the fake server accepted a video note as a cached video")
+	}
+	if answers[1].Err != "" {
+		t.Fatalf("explanation failed: %s", answers[1].Err)
+	}
+	var button telegram.InlineQueryResultsButton
+	if err := json.Unmarshal([]byte(answers[1].Params.Get("button")), &button); err != nil {
+		t.Fatalf("no button in the explanation: %v", err)
+	}
+	if button.StartParameter != inlineFailedStart {
+		t.Errorf("button start_parameter = %q, want %q", button.StartParameter, inlineFailedStart)
+	}
+
+	bot.handleUpdate(privateMessage(testUserID, "/start "+inlineFailedStart))
+	replies := srv.Requests("sendMessage")
+	if len(replies) != 1 || replies[0].Params.Get("text") != inlineFailedText {
+		t.Errorf("got %d replies to /start %s, want the explanation", len(replies), inlineFailedStart)
+	}
+}
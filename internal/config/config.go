@@ -0,0 +1,182 @@
+// Package config loads config.json.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+type Config struct {
+	BotToken string `json:"bot_token"`
+	// BotTokenFile and BotTokenCommand are read, or run with sh -c, for the token when
+	// bot_token is empty, so it need not be stored in config.json.
+	BotTokenFile    string `json:"bot_token_file,omitempty"`
+	BotTokenCommand string `json:"bot_token_command,omitempty"`
+	// APIURL points the Bot API client at another server; empty means the official one.
+	APIURL          string           `json:"api_url,omitempty"`
+	ChatID          string           `json:"chat_id"`
+	ChatIDTest      string           `json:"chat_id_test"`
+	MessageTemplate string           `json:"message_template,omitempty"`
+	ParseMode       string           `json:"parse_mode,omitempty"`
+	Hashtags        []string         `json:"hashtags,omitempty"`
+	Destinations    []Destination    `json:"destinations,omitempty"`
+	Bot             BotConfig        `json:"bot"`
+	Moderation      ModerationConfig `json:"moderation"`
+	Workers         WorkersConfig    `json:"workers"`
+	// DuplicateWindow is how long the same track may not be posted to the same chat again.
+	DuplicateWindow string `json:"duplicate_window,omitempty"`
+}
+
+// Load reads a config file, applies TGCIRCLE_* environment overrides, resolves the bot
+// token and checks the result. An empty path means no file: everything comes from the
+// environment.
+func Load(path string) (*Config, error) {
+	var config Config
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		err = json.NewDecoder(file).Decode(&config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if config.BotTokenFile != "" && !filepath.IsAbs(config.BotTokenFile) {
+			config.BotTokenFile = filepath.Join(filepath.Dir(path), config.BotTokenFile)
+		}
+	}
+	if err := applyEnv(&config, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := config.resolveBotToken(); err != nil {
+		return nil, err
+	}
+	if _, err := ParseDuplicateWindow(config.DuplicateWindow); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// resolveBotToken fills in bot_token from bot_token_file or bot_token_command when it is
+// not set directly. Surrounding whitespace, such as a trailing newline, is dropped.
+func (c *Config) resolveBotToken() error {
+	switch {
+	case c.BotToken != "":
+	case c.BotTokenFile != "":
+		data, err := os.ReadFile(c.BotTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read bot_token_file: %w", err)
+		}
+		c.BotToken = strings.TrimSpace(string(data))
+	case c.BotTokenCommand != "":
+		cmd := exec.Command("sh", "-c", c.BotTokenCommand)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("bot_token_command failed: %w", err)
+		}
+		c.BotToken = strings.TrimSpace(string(out))
+	default:
+		return nil
+	}
+	if c.BotToken == "" {
+		return errors.New("bot_token_file or bot_token_command produced an empty token")
+	}
+	return nil
+}
+
+// TelegramClient returns a Bot API client for the configured bot and server.
+func (c *Config) TelegramClient() *telegram.Client {
+	tg := telegram.NewClient(c.BotToken)
+	tg.BaseURL = c.APIURL
+	return tg
+}
+
+// LegacyChatID returns chat_id, or chat_id_test with useTestChannel.
+func (c *Config) LegacyChatID(useTestChannel bool) string {
+	if useTestChannel {
+		return c.ChatIDTest
+	}
+	return c.ChatID
+}
+
+// BotConfig configures the interactive bot mode.
+type BotConfig struct {
+	// AllowedUsers are the Telegram user IDs allowed to make circles through the bot.
+	AllowedUsers []int64 `json:"allowed_users,omitempty"`
+	// PublishTo lists destination names approved circles are posted to; empty means chat_id.
+	PublishTo []string `json:"publish_to,omitempty"`
+	WorkDir   string   `json:"work_dir,omitempty"`
+	// WebhookURL switches the bot from long polling to receiving updates over HTTPS.
+	WebhookURL    string `json:"webhook_url,omitempty"`
+	WebhookListen string `json:"webhook_listen,omitempty"`
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+	// InlineForEveryone lets any user search posted circles via inline queries, not only AllowedUsers.
+	InlineForEveryone bool `json:"inline_for_everyone,omitempty"`
+}
+
+// ModerationConfig enables the review stage: clips for moderated destinations are first sent
+// to ChatID with Approve/Reject/Re-cut buttons, which the bot command acts on.
+type ModerationConfig struct {
+	// ChatID is the numeric ID of the moderators' chat.
+	ChatID string `json:"chat_id,omitempty"`
+	// Moderators may press the review buttons; if empty, anyone in ChatID may.
+	Moderators []int64 `json:"moderators,omitempty"`
+}
+
+func (m ModerationConfig) Enabled() bool {
+	return m.ChatID != ""
+}
+
+// WorkersConfig limits how many downloads and encodes run at the same time.
+type WorkersConfig struct {
+	Downloads int `json:"downloads,omitempty"`
+	Encodes   int `json:"encodes,omitempty"`
+}
+
+// Limits returns the configured limits, filling in defaults for unset ones.
+func (w WorkersConfig) Limits() (downloads, encodes int) {
+	downloads, encodes = w.Downloads, w.Encodes
+	if downloads <= 0 {
+		downloads = 2
+	}
+	if encodes <= 0 {
+		encodes = max(runtime.NumCPU()/2, 1)
+	}
+	return downloads, encodes
+}
+
+// DefaultDuplicateWindow is how long a track may not be posted to the same chat again.
+const DefaultDuplicateWindow = 30 * 24 * time.Hour
+
+// ParseDuplicateWindow parses the duplicate_window setting: a Go duration such as "72h"
+// or a number of days such as "30d". An empty value means the default; "0" turns the
+// check off.
+func ParseDuplicateWindow(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultDuplicateWindow, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duplicate_window %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		return 0, fmt.Errorf("invalid duplicate_window %q", value)
+	}
+	return window, nil
+}
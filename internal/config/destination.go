@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+const (
+	DestinationChannel = "channel"
+	DestinationGroup   = "group"
+	DestinationTopic   = "topic"
+	DestinationPrivate = "private"
+)
+
+// Destination is a named chat from config.json that a video note can be published to.
+type Destination struct {
+	Name            string `json:"name"`
+	Type            string `json:"type,omitempty"`
+	ChatID          string `json:"chat_id"`
+	MessageThreadID int    `json:"message_thread_id,omitempty"`
+	MessageTemplate string `json:"message_template,omitempty"`
+	ParseMode       string `json:"parse_mode,omitempty"`
+	Silent          bool   `json:"silent,omitempty"`
+	Enabled         *bool  `json:"enabled,omitempty"`
+	// Moderated destinations only get clips a moderator approved, when moderation is configured.
+	Moderated bool `json:"moderated,omitempty"`
+}
+
+// IsEnabled reports whether the destination may be posted to; destinations are enabled unless disabled explicitly.
+func (d Destination) IsEnabled() bool {
+	return d.Enabled == nil || *d.Enabled
+}
+
+func (d Destination) SendOptions() telegram.SendOptions {
+	return telegram.SendOptions{
+		MessageThreadID:     d.MessageThreadID,
+		DisableNotification: d.Silent,
+	}
+}
+
+func (d Destination) validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("destination with chat_id %q has no name", d.ChatID)
+	}
+	if d.ChatID == "" {
+		return fmt.Errorf("destination %q has no chat_id", d.Name)
+	}
+	switch d.Type {
+	case "", DestinationChannel, DestinationGroup, DestinationPrivate:
+	case DestinationTopic:
+		if d.MessageThreadID == 0 {
+			return fmt.Errorf("destination %q is a forum topic but has no message_thread_id", d.Name)
+		}
+	default:
+		return fmt.Errorf("destination %q has unknown type %q (expected channel, group, topic or private)", d.Name, d.Type)
+	}
+	return nil
+}
+
+// ResolveDestinations picks the destinations for this run. Without names the legacy
+// chat_id / chat_id_test pair is used; the special name "all" selects every enabled destination.
+func (c *Config) ResolveDestinations(names []string, useTestChannel bool) ([]Destination, error) {
+	for _, d := range c.Destinations {
+		if err := d.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(names) == 0 {
+		name := "main"
+		if useTestChannel {
+			name = "test"
+		}
+		chatID := c.LegacyChatID(useTestChannel)
+		if chatID == "" {
+			return nil, fmt.Errorf("no chat_id configured for %q channel; set it in config.json or use -to", name)
+		}
+		// The main channel is always moderated; the test channel never is.
+		return []Destination{{Name: name, ChatID: chatID, Moderated: !useTestChannel}}, nil
+	}
+
+	var selected []Destination
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "all" {
+			for _, d := range c.Destinations {
+				if d.IsEnabled() && !seen[d.Name] {
+					seen[d.Name] = true
+					selected = append(selected, d)
+				}
+			}
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		d, ok := c.FindDestination(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown destination %q", name)
+		}
+		if !d.IsEnabled() {
+			return nil, fmt.Errorf("destination %q is disabled in config.json", name)
+		}
+		seen[name] = true
+		selected = append(selected, d)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no enabled destinations selected")
+	}
+	return selected, nil
+}
+
+func (c *Config) FindDestination(name string) (Destination, bool) {
+	for _, d := range c.Destinations {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Destination{}, false
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables that override config fields.
+const EnvPrefix = "TGCIRCLE_"
+
+// EnvVars lists the environment variable for every config field, e.g. TGCIRCLE_BOT_TOKEN
+// for bot_token and TGCIRCLE_BOT_ALLOWED_USERS for bot.allowed_users.
+func EnvVars() []string {
+	var names []string
+	walkEnvFields(reflect.ValueOf(&Config{}).Elem(), EnvPrefix, func(name string, _ reflect.Value) {
+		names = append(names, name)
+	})
+	return names
+}
+
+// applyEnv overrides fields of c with the TGCIRCLE_* variables set in environ. Lists of
+// strings or numbers are comma-separated; destinations take a JSON array.
+func applyEnv(c *Config, environ []string) error {
+	values := make(map[string]string)
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(name, EnvPrefix) {
+			values[name] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	// A token given in the environment replaces whichever way the file provides it.
+	for _, name := range []string{"BOT_TOKEN", "BOT_TOKEN_FILE", "BOT_TOKEN_COMMAND"} {
+		if _, ok := values[EnvPrefix+name]; ok {
+			c.BotToken, c.BotTokenFile, c.BotTokenCommand = "", "", ""
+			break
+		}
+	}
+
+	var err error
+	walkEnvFields(reflect.ValueOf(c).Elem(), EnvPrefix, func(name string, field reflect.Value) {
+		value, ok := values[name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := setField(field, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", name, setErr)
+		}
+	})
+	return err
+}
+
+// walkEnvFields calls fn with the variable name of every settable field below v, naming
+// them after their JSON keys. Nested structs such as bot and moderation are descended into.
+func walkEnvFields(v reflect.Value, prefix string, fn func(name string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkEnvFields(field, name+"_", fn)
+			continue
+		}
+		fn(name, field)
+	}
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		elem := field.Type().Elem().Kind()
+		if elem != reflect.String && elem != reflect.Int64 {
+			return json.Unmarshal([]byte(value), field.Addr().Interface())
+		}
+		parts := strings.Split(value, ",")
+		list := reflect.MakeSlice(field.Type(), 0, len(parts))
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			item := reflect.New(field.Type().Elem()).Elem()
+			if err := setField(item, part); err != nil {
+				return err
+			}
+			list = reflect.Append(list, item)
+		}
+		field.Set(list)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileName is the name config files are searched for.
+const FileName = "config.json"
+
+// SearchPaths returns where a config file is looked for, in order: the working directory,
+// $XDG_CONFIG_HOME/tgcircle (or ~/.config/tgcircle) and the directory of the executable.
+func SearchPaths() []string {
+	paths := []string{FileName}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "tgcircle", FileName))
+	}
+	if exe, err := os.Executable(); err == nil {
+		if exe, err := filepath.EvalSymlinks(exe); err == nil {
+			paths = append(paths, filepath.Join(filepath.Dir(exe), FileName))
+		}
+	}
+	return paths
+}
+
+// Find returns the config file to use. An explicit path, from a -config flag or
+// TGCIRCLE_CONFIG, must exist; otherwise the first file found in SearchPaths is used.
+// If there is none but TGCIRCLE_BOT_TOKEN is set, Find returns "" so the whole
+// configuration comes from the environment.
+func Find(explicit string) (string, error) {
+	if explicit == "" {
+		explicit = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err != nil {
+			return "", err
+		}
+		return explicit, nil
+	}
+
+	paths := SearchPaths()
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	if os.Getenv(EnvPrefix+"BOT_TOKEN") != "" {
+		return "", nil
+	}
+	return "", fmt.Errorf("%w: no %s in %v; pass -config or set %sCONFIG", os.ErrNotExist, FileName, paths, EnvPrefix)
+}
+
+// LoadFrom finds the config file as Find does and loads it. It also returns the path
+// used, which is empty when everything came from the environment.
+func LoadFrom(explicit string) (*Config, string, error) {
+	path, err := Find(explicit)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		if path != "" && !errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+		return nil, path, err
+	}
+	return cfg, path, nil
+}
@@ -0,0 +1,130 @@
+// Package download fetches source videos with yt-dlp.
+package download
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+)
+
+// YTDLP downloads videos by running yt-dlp.
+type YTDLP struct {
+	// Cookies is a cookies file passed to yt-dlp for age-restricted videos; empty means none.
+	Cookies string
+}
+
+// Download saves the video at youtubeURL as an mp4 file at fullFilepath. yt-dlp fetches
+// the video and audio streams one after the other, so progress runs from 0 to 1 for each.
+func (d *YTDLP) Download(youtubeURL, fullFilepath string, progress func(fraction float64)) error {
+	args := []string{
+		"-f", "bestvideo+bestaudio/best",
+		"--merge-output-format", "mp4",
+		"-o", fullFilepath,
+	}
+	if d.Cookies != "" {
+		args = append(args, "--cookies", d.Cookies)
+	}
+	args = append(args, youtubeURL)
+	cmd := exec.Command("yt-dlp", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var out io.Reader = stdout
+	if progress != nil {
+		out = io.TeeReader(stdout, &progressWriter{progress: progress})
+	}
+	// Read both streams to the end before Wait closes them.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); printStream(logging.Output, out) }()
+	go func() { defer wg.Done(); printStream(logging.Output, stderr) }()
+	wg.Wait()
+
+	return cmd.Wait()
+}
+
+// printStream copies yt-dlp's output to w, redrawing its progress lines in place.
+func printStream(w io.Writer, reader io.Reader) {
+	r := bufio.NewReader(reader)
+	var lastLineWasProgress bool // Flag to track if the previous line was a progress line
+
+	for {
+		buf := make([]byte, 2048)
+		n, err := r.Read(buf)
+
+		if n > 0 {
+			text := string(buf[:n])
+
+			cleanText := strings.TrimSuffix(text, "\n")
+			cleanText = strings.TrimSuffix(cleanText, "\r")
+
+			if cleanText != "" {
+
+				fmt.Fprintf(w, "\r\033[K%s", cleanText)
+				// The line is redrawn in place, so it is left unterminated until something follows it.
+				lastLineWasProgress = true
+			} else if strings.Contains(text, "\n") {
+
+				if lastLineWasProgress {
+					fmt.Fprintln(w)
+				}
+				lastLineWasProgress = false
+			}
+		}
+
+		if err != nil {
+			if lastLineWasProgress {
+				fmt.Fprintln(w)
+			}
+			if err != io.EOF {
+				slog.Warn("Failed to read yt-dlp output", "err", err)
+			}
+			break
+		}
+	}
+}
+
+// progressLine matches yt-dlp's progress lines, e.g. "[download]  42.3% of 3.20MiB at ...".
+var progressLine = regexp.MustCompile(`^\[download\]\s+(\d+(?:\.\d+)?)%`)
+
+// progressWriter picks the progress lines out of yt-dlp's output. They end in a carriage
+// return rather than a newline, since yt-dlp redraws them in place.
+type progressWriter struct {
+	progress func(float64)
+	line     []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			w.line = append(w.line, b)
+			continue
+		}
+		if m := progressLine.FindSubmatch(w.line); m != nil {
+			if percent, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+				w.progress(percent / 100)
+			}
+		}
+		w.line = w.line[:0]
+	}
+	return len(p), nil
+}
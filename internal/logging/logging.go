@@ -0,0 +1,155 @@
+// Package logging sets up the structured log: how much of it is written, where it goes and
+// which secrets are kept out of it. It also decides whether the output of yt-dlp and ffmpeg
+// is shown.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Options configure New.
+type Options struct {
+	// Level is the lowest level written to the console.
+	Level slog.Level
+	// File, if set, is appended every record at debug level and above, whatever Level is,
+	// so a run can be looked into afterwards.
+	File string
+}
+
+// New returns a logger writing text to w and, if there is a log file, JSON to the file,
+// which stays open until the process exits. Secrets are redacted from every record.
+// Output follows opts.Level from then on.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	consoleLevel.Store(int64(opts.Level))
+	handler := slog.Handler(slog.NewTextHandler(w, &slog.HandlerOptions{Level: opts.Level, ReplaceAttr: redactAttr}))
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		fileHandler := slog.NewJSONHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redactAttr})
+		handler = fanout{handler, fileHandler}
+	}
+	return slog.New(handler), nil
+}
+
+// fanout hands every record to each of its handlers that is enabled for the record's level.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// consoleLevel is the Level of the last logger made by New.
+var consoleLevel atomic.Int64
+
+// Output is where the output and progress of yt-dlp and ffmpeg go. It passes them on to
+// stderr when the console log shows info records, and drops them when it only shows
+// warnings and errors, as with -q.
+var Output io.Writer = toolOutput{}
+
+type toolOutput struct{}
+
+func (toolOutput) Write(p []byte) (int, error) {
+	if slog.Level(consoleLevel.Load()) > slog.LevelInfo {
+		return len(p), nil
+	}
+	// os.Stderr is looked up on every write, since -output=json replaces it.
+	return os.Stderr.Write(p)
+}
+
+const redacted = "[REDACTED]"
+
+var (
+	// botTokenPattern matches Bot API tokens, which are a bot ID, a colon and 35 characters.
+	// Bot API URLs carry the token in their path, e.g. /bot123456:AAH.../sendMessage, so
+	// that form is matched whatever the token looks like.
+	botTokenPattern = regexp.MustCompile(`/bot\d+:[^/\s"]+|\b\d+:[A-Za-z0-9_-]{30,}`)
+
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// AddSecret makes Redact, and so every log record, hide s from now on. Empty strings are
+// ignored.
+func AddSecret(s string) {
+	if s == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = append(secrets, s)
+}
+
+// Redact hides bot tokens and the secrets added with AddSecret in s.
+func Redact(s string) string {
+	s = botTokenPattern.ReplaceAllStringFunc(s, func(token string) string {
+		if strings.HasPrefix(token, "/bot") {
+			return "/bot" + redacted
+		}
+		return redacted
+	})
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// redactAttr is a ReplaceAttr function that redacts the message and every string, error
+// or Stringer value.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(Redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(Redact(v.String()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,35 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestOutputFollowsLevel(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	t.Cleanup(func() { os.Stderr = stderr })
+
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn} {
+		if _, err := New(io.Discard, Options{Level: level}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(Output, level.String()+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "DEBUG\nINFO\n"; string(got) != want {
+		t.Errorf("Output wrote %q, want %q", got, want)
+	}
+}
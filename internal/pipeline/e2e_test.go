@@ -0,0 +1,181 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/resolve"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram/telegramtest"
+	"github.com/Ma11doror/tgCircleGen/internal/transcode"
+)
+
+// copyDownloader "downloads" by copying a local file, so no network is needed.
+type copyDownloader struct {
+	source string
+}
+
+func (d copyDownloader) Download(_, path string, _ func(float64)) error {
+	data, err := os.ReadFile(d.source)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// e2eDestinations are a channel with the default MarkdownV2 template and a forum topic
+// with an HTML template using every kind of markup.
+func e2eDestinations(t *testing.T) []config.Destination {
+	t.Helper()
+	cfg := &config.Config{Hashtags: []string{"#music"}}
+	destinations, err := ApplyMessageTemplates([]config.Destination{
+		{Name: "channel", Type: config.DestinationChannel, ChatID: "@channel"},
+		{
+			Name:            "topic",
+			Type:            config.DestinationTopic,
+			ChatID:          "-1001234567890",
+			MessageThreadID: 42,
+			Silent:          true,
+			MessageTemplate: `{{bold .Title}} {{italic .Artist}} {{link "listen" .URL}} ({{.Duration}}) {{join .Hashtags " "}}`,
+			ParseMode:       telegram.ParseModeHTML,
+		},
+	}, cfg, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return destinations
+}
+
+// checkPublished asserts that both destinations got a link message with valid markup and
+// a video note, the first uploaded and the second sent by the first one's file_id.
+func checkPublished(t *testing.T, srv *telegramtest.Server, results []PublishResult, duration int) {
+	t.Helper()
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("%s: %v", result.Destination.Name, result.Err)
+		}
+	}
+	for _, r := range srv.Requests("") {
+		if r.Err != "" {
+			t.Errorf("%s was refused: %s", r.Method, r.Err)
+		}
+	}
+
+	messages := srv.Requests("sendMessage")
+	if len(messages) != 2 {
+		t.Fatalf("got %d sendMessage calls, want 2", len(messages))
+	}
+	wantMessages := []struct {
+		chat, parseMode, text, thread, silent string
+	}{
+		{"@channel", telegram.ParseModeMarkdownV2, `["Song\-1" by The Band](https://song.link/s/1)`, "", ""},
+		{"-1001234567890", telegram.ParseModeHTML, `<b>Song-1</b> <i>The Band</i> <a href="https://song.link/s/1">listen</a> (00:` + fmt.Sprintf("%02d", duration) + `) #music #TheBand`, "42", "true"},
+	}
+	for i, want := range wantMessages {
+		p := messages[i].Params
+		if p.Get("chat_id") != want.chat || p.Get("parse_mode") != want.parseMode || p.Get("text") != want.text {
+			t.Errorf("message %d: chat %s, %s %q; want chat %s, %s %q", i, p.Get("chat_id"), p.Get("parse_mode"), p.Get("text"), want.chat, want.parseMode, want.text)
+		}
+		if p.Get("message_thread_id") != want.thread || p.Get("disable_notification") != want.silent {
+			t.Errorf("message %d: thread %q, silent %q; want %q, %q", i, p.Get("message_thread_id"), p.Get("disable_notification"), want.thread, want.silent)
+		}
+	}
+
+	notes := srv.Requests("sendVideoNote")
+	if len(notes) != 2 {
+		t.Fatalf("got %d sendVideoNote calls, want 2", len(notes))
+	}
+	upload, ok := notes[0].Files["video_note"]
+	if !ok || len(upload.Data) == 0 {
+		t.Fatal("first video note was not uploaded")
+	}
+	if p := notes[0].Params; p.Get("length") != strconv.Itoa(VideoNoteLength) || p.Get("duration") != strconv.Itoa(duration) {
+		t.Errorf("upload: length %s, duration %s", p.Get("length"), p.Get("duration"))
+	}
+	fileID := results[0].VideoNote.VideoNote.FileID
+	if _, uploaded := notes[1].Files["video_note"]; uploaded || notes[1].Params.Get("video_note") != fileID {
+		t.Errorf("second video note was not sent by file_id %s", fileID)
+	}
+	if notes[1].Params.Get("message_thread_id") != "42" {
+		t.Errorf("second video note went to thread %q", notes[1].Params.Get("message_thread_id"))
+	}
+}
+
+func TestPublishToFakeServer(t *testing.T) {
+	srv := telegramtest.NewServer("123:abc")
+	defer srv.Close()
+
+	clipPath := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(clipPath, []byte("not really a video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Pipeline{Publisher: srv.Client()}
+	data := MessageData{Display: `"Song-1" by The Band`, Title: "Song-1", Artist: "The Band", URL: "https://song.link/s/1", DurationSeconds: 20, Hashtags: []string{"#music", "#TheBand"}}
+
+	results := p.Publish(e2eDestinations(t), data, clipPath, "", VideoNoteLength, 20)
+	checkPublished(t, srv, results, 20)
+}
+
+// TestEndToEnd runs a generated test video through every stage with the real ffmpeg and
+// publishes it to the fake Bot API.
+func TestEndToEnd(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.mp4")
+	generate := exec.Command("ffmpeg",
+		"-f", "lavfi", "-i", "testsrc=size=640x360:rate=30:duration=14",
+		"-f", "lavfi", "-i", "sine=frequency=440:duration=14",
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest", "-y", source)
+	if out, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate test video: %v\n%s", err, out)
+	}
+
+	srv := telegramtest.NewServer("123:abc")
+	defer srv.Close()
+	p := &Pipeline{
+		Resolver:   &fakeResolver{track: resolve.TrackInfo{Title: "Song-1", Artist: "The Band", YoutubeURL: "https://www.youtube.com/watch?v=abc"}},
+		Downloader: copyDownloader{source: source},
+		Transcoder: &transcode.FFmpeg{},
+		Publisher:  srv.Client(),
+	}
+	cfg := &config.Config{Hashtags: []string{"#music"}}
+	destinations := e2eDestinations(t)
+
+	clip, err := p.Make(ClipRequest{URL: "https://song.link/s/1", Start: 2, Duration: 10, WorkDir: filepath.Join(dir, "work")})
+	if err != nil {
+		t.Fatalf("Make: %v", err)
+	}
+	results := p.Publish(destinations, p.MessageData(clip, cfg, destinations), clip.Path, "", VideoNoteLength, clip.Request.Duration)
+	checkPublished(t, srv, results, 10)
+
+	clipData, err := os.ReadFile(clip.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload := srv.Requests("sendVideoNote")[0].Files["video_note"]; string(upload.Data) != string(clipData) {
+		t.Error("the uploaded video note is not the encoded clip")
+	}
+	if _, err := exec.LookPath("ffprobe"); err == nil {
+		out, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width,height", "-of", "json", clip.Path).Output()
+		if err != nil {
+			t.Fatalf("ffprobe: %v", err)
+		}
+		var probe struct {
+			Streams []struct{ Width, Height int } `json:"streams"`
+		}
+		if err := json.Unmarshal(out, &probe); err != nil || len(probe.Streams) != 1 {
+			t.Fatalf("ffprobe output %s: %v", out, err)
+		}
+		if s := probe.Streams[0]; s.Width != transcode.VideoNoteSize || s.Height != transcode.VideoNoteSize {
+			t.Errorf("clip is %dx%d, want %dx%d", s.Width, s.Height, transcode.VideoNoteSize, transcode.VideoNoteSize)
+		}
+	}
+}
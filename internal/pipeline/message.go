@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+const defaultMessageTemplate = `{{link .Display .URL}}`
+
+// MessageData is passed to message templates. Values are raw text: every {{...}} action is
+// escaped for the destination's parse_mode automatically, so templates never escape by hand.
+type MessageData struct {
+	// Display is the link text used by the default template, e.g. "Song" by Artist.
+	Display         string            `json:"display"`
+	Title           string            `json:"title,omitempty"`
+	Artist          string            `json:"artist,omitempty"`
+	URL             string            `json:"url"`
+	YoutubeURL      string            `json:"youtube_url,omitempty"`
+	Start           int               `json:"start"`
+	DurationSeconds int               `json:"duration_seconds"`
+	Links           map[string]string `json:"links,omitempty"`
+	Hashtags        []string          `json:"hashtags,omitempty"`
+}
+
+// Duration is the clip length as mm:ss.
+func (d MessageData) Duration() string {
+	return FormatDuration(d.DurationSeconds)
+}
+
+// markup is template output that is already formatted for the parse mode and must not be escaped again.
+type markup string
+
+func messageTemplateFuncs(f telegram.Formatter) template.FuncMap {
+	// text returns the argument unescaped if it already is markup, so nested helpers compose.
+	text := func(v any) string {
+		if m, ok := v.(markup); ok {
+			return string(m)
+		}
+		return f.Text(fmt.Sprint(v))
+	}
+	return template.FuncMap{
+		"escape": func(v any) markup {
+			return markup(text(v))
+		},
+		"link": func(label any, linkURL string) markup {
+			return markup(f.Link(text(label), linkURL))
+		},
+		"bold": func(v any) markup {
+			return markup(f.Bold(text(v)))
+		},
+		"italic": func(v any) markup {
+			return markup(f.Italic(text(v)))
+		},
+		"hashtag": toHashtag,
+		"join": func(items []string, sep string) string {
+			return strings.Join(items, sep)
+		},
+	}
+}
+
+// compileMessageTemplate parses a message template for the given parse_mode and makes every
+// action that produces output pass through escape, the way html/template escapes its actions.
+func compileMessageTemplate(text, parseMode string) (*template.Template, error) {
+	f, err := telegram.FormatterFor(parseMode)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("message").Funcs(messageTemplateFuncs(f)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			addEscapeToActions(t.Tree, t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
+
+func addEscapeToActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			addEscapeToActions(tree, child)
+		}
+	case *parse.ActionNode:
+		// Variable declarations print nothing.
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		escape := parse.NewIdentifier("escape").SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{escape},
+		})
+	case *parse.IfNode:
+		addEscapeToActions(tree, n.List)
+		addEscapeToActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		addEscapeToActions(tree, n.List)
+		addEscapeToActions(tree, n.ElseList)
+	case *parse.WithNode:
+		addEscapeToActions(tree, n.List)
+		addEscapeToActions(tree, n.ElseList)
+	}
+}
+
+func RenderMessage(text, parseMode string, data MessageData) (string, error) {
+	tmpl, err := compileMessageTemplate(text, parseMode)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// toHashtag turns arbitrary text into a Telegram hashtag, e.g. "Daft Punk" -> "#DaftPunk".
+func toHashtag(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "#" + sb.String()
+}
+
+// ApplyMessageTemplates fills in the template and parse_mode each destination will use,
+// so queued jobs carry their final formatting. A per-run template overrides everything,
+// then the destination's own settings, then the config-wide ones, then the defaults.
+// All resulting templates are compiled to catch mistakes before any work is done.
+func ApplyMessageTemplates(destinations []config.Destination, cfg *config.Config, runTemplate, runParseMode string) ([]config.Destination, error) {
+	prepared := make([]config.Destination, len(destinations))
+	for i, d := range destinations {
+		if runTemplate != "" {
+			d.MessageTemplate = runTemplate
+		} else if d.MessageTemplate == "" {
+			d.MessageTemplate = cfg.MessageTemplate
+		}
+		if d.MessageTemplate == "" {
+			d.MessageTemplate = defaultMessageTemplate
+		}
+
+		if runParseMode != "" {
+			d.ParseMode = runParseMode
+		} else if d.ParseMode == "" {
+			d.ParseMode = cfg.ParseMode
+		}
+		if d.ParseMode == "" {
+			d.ParseMode = telegram.ParseModeMarkdownV2
+		}
+
+		if _, err := compileMessageTemplate(d.MessageTemplate, d.ParseMode); err != nil {
+			return nil, fmt.Errorf("destination %q: %w", d.Name, err)
+		}
+		prepared[i] = d
+	}
+	return prepared, nil
+}
+
+// TemplatesUseLinks reports whether any destination's template refers to platform links,
+// which require an extra request to song.link.
+func TemplatesUseLinks(destinations []config.Destination) bool {
+	for _, d := range destinations {
+		if strings.Contains(d.MessageTemplate, ".Links") {
+			return true
+		}
+	}
+	return false
+}
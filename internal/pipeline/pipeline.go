@@ -0,0 +1,326 @@
+// Package pipeline turns a song link into a published video note: it resolves the track,
+// downloads the source, cuts the clip and posts it, each stage behind an interface.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/download"
+	"github.com/Ma11doror/tgCircleGen/internal/resolve"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+	"github.com/Ma11doror/tgCircleGen/internal/transcode"
+)
+
+const (
+	MinClipDuration = 10
+	MaxClipDuration = 60
+	VideoNoteLength = transcode.VideoNoteSize
+)
+
+// Resolver looks up what a song link points to.
+type Resolver interface {
+	Resolve(songURL string, logger *slog.Logger) resolve.TrackInfo
+	PlatformLinks(songURL string) (map[string]string, error)
+}
+
+// Downloader saves a source video to a local file. If progress is not nil, it is called
+// with how far the download has got, from 0 to 1.
+type Downloader interface {
+	Download(url, path string, progress func(fraction float64)) error
+}
+
+// Transcoder cuts a video note out of a source video. If progress is not nil, it is called
+// with how far the encode has got, from 0 to 1.
+type Transcoder interface {
+	Cut(input, output string, start, duration int, progress func(fraction float64)) error
+}
+
+// Publisher posts messages and video notes to Telegram chats.
+type Publisher interface {
+	SendMessage(chatID, text, parseMode string, disablePreview bool, opts telegram.SendOptions) (*telegram.Message, error)
+	SendVideoNote(chatID, videoPath string, length, duration int, opts telegram.SendOptions) (*telegram.Message, error)
+	SendVideoNoteByFileID(chatID, fileID string, opts telegram.SendOptions) (*telegram.Message, error)
+}
+
+// Pipeline runs the stages of making and publishing a clip.
+type Pipeline struct {
+	Resolver   Resolver
+	Downloader Downloader
+	Transcoder Transcoder
+	Publisher  Publisher
+}
+
+// New returns a Pipeline using song.link, yt-dlp, ffmpeg and the Bot API.
+func New(cfg *config.Config, cookies string) *Pipeline {
+	return &Pipeline{
+		Resolver:   &resolve.Resolver{},
+		Downloader: &download.YTDLP{Cookies: cookies},
+		Transcoder: &transcode.FFmpeg{},
+		Publisher:  cfg.TelegramClient(),
+	}
+}
+
+// ClampDuration validates a requested clip duration. Durations above the video note limit
+// are clamped, which is reported through clamped so callers can warn about it.
+func ClampDuration(seconds int) (duration int, clamped bool, err error) {
+	if seconds < MinClipDuration {
+		return 0, false, fmt.Errorf("min duration is %d seconds, got %d", MinClipDuration, seconds)
+	}
+	if seconds > MaxClipDuration {
+		return MaxClipDuration, true, nil
+	}
+	return seconds, false, nil
+}
+
+// ClipRequest describes one circle to make. SongName and AuthorName override the
+// resolved title and artist when both are set.
+type ClipRequest struct {
+	URL        string
+	Start      int
+	Duration   int
+	SongName   string
+	AuthorName string
+	WorkDir    string
+}
+
+// Clip is a rendered video note together with what is known about its track.
+type Clip struct {
+	Request      ClipRequest
+	Track        resolve.TrackInfo
+	Display      string
+	FilenameBase string
+	DownloadURL  string
+	SourcePath   string
+	Path         string
+	// Log is where everything about the clip is logged; nil means the default logger.
+	Log *slog.Logger
+}
+
+func (c *Clip) logger(stage Stage) *slog.Logger {
+	if c.Log == nil {
+		return slog.Default().With("url", c.Request.URL, "stage", stage)
+	}
+	return c.Log.With("stage", stage)
+}
+
+// Make prepares, downloads and cuts a clip in one go.
+func (p *Pipeline) Make(req ClipRequest) (*Clip, error) {
+	clip, err := p.Prepare(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Download(clip, nil); err != nil {
+		return nil, err
+	}
+	if err := p.Cut(clip, nil); err != nil {
+		return nil, err
+	}
+	return clip, nil
+}
+
+// Prepare resolves the track and works out the display text and file paths of a clip,
+// without downloading anything yet. The clip is logged to logger, which should say which
+// job it belongs to; nil means the default logger.
+func (p *Pipeline) Prepare(req ClipRequest, logger *slog.Logger) (*Clip, error) {
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &StageError{StageResolve, fmt.Errorf("%q is not an http(s) link", req.URL)}
+	}
+	clip := &Clip{Request: req, Log: logger}
+	log := clip.logger(StageResolve)
+	clip.Track = p.Resolver.Resolve(req.URL, log)
+
+	clip.DownloadURL = clip.Track.YoutubeURL
+	if clip.DownloadURL == "" {
+		log.Info("No YouTube URL found, passing the song link to yt-dlp")
+		clip.DownloadURL = req.URL
+	}
+
+	var filenameBaseText string
+	if req.SongName != "" && req.AuthorName != "" {
+		clip.Track.Title, clip.Track.Artist = req.SongName, req.AuthorName
+		clip.Display = fmt.Sprintf("\"%s\" by %s", req.SongName, req.AuthorName)
+		filenameBaseText = fmt.Sprintf("%s by %s", req.SongName, req.AuthorName)
+		log.Debug("Using custom display text", "display", clip.Display)
+	} else {
+		title, artist := clip.Track.Title, clip.Track.Artist
+		if title != "" && artist != "" {
+			clip.Display = fmt.Sprintf("\"%s\" by %s", title, artist)
+			filenameBaseText = fmt.Sprintf("%s by %s", title, artist)
+		} else if title != "" {
+			clip.Display = fmt.Sprintf("\"%s\"", title)
+			filenameBaseText = title
+		} else if artist != "" {
+			clip.Display = fmt.Sprintf("Unknown Song by %s", artist)
+			filenameBaseText = artist
+		} else {
+			log.Info("No title or artist found, using a generic file name and the link as text")
+			timestamp := time.Now().Unix()
+			filenameBaseText = fmt.Sprintf("track_%d", timestamp)
+			clip.Display = req.URL
+		}
+	}
+
+	clip.FilenameBase = sanitizeFilename(filenameBaseText)
+	if clip.FilenameBase == "" || clip.FilenameBase == "_" {
+		clip.FilenameBase = fmt.Sprintf("track_%d_fallback", time.Now().Unix())
+	}
+
+	if err := os.MkdirAll(req.WorkDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create work directory %s: %w", req.WorkDir, err)
+	}
+	clip.SourcePath = filepath.Join(req.WorkDir, clip.FilenameBase+".mp4")
+	clip.Path = filepath.Join(req.WorkDir, clip.FilenameBase+"_cut.mp4")
+	return clip, nil
+}
+
+// Download fetches the clip's source video, reporting to progress if it is not nil.
+func (p *Pipeline) Download(c *Clip, progress func(fraction float64)) error {
+	c.logger(StageDownload).Info("Downloading video", "download_url", c.DownloadURL, "path", c.SourcePath)
+	if err := p.Downloader.Download(c.DownloadURL, c.SourcePath, progress); err != nil {
+		stage := StageDownload
+		// Without a YouTube link yt-dlp was handed the song link itself, so unless yt-dlp
+		// could not be started at all, its failure means the link could not be resolved.
+		var execErr *exec.Error
+		if c.Track.YoutubeURL == "" && !errors.As(err, &execErr) {
+			stage = StageResolve
+		}
+		return &StageError{stage, fmt.Errorf("failed to download video: %w", err)}
+	}
+	return nil
+}
+
+// Cut encodes the video note from the downloaded source, reporting to progress if it is
+// not nil.
+func (p *Pipeline) Cut(c *Clip, progress func(fraction float64)) error {
+	c.logger(StageEncode).Debug("Encoding", "start", c.Request.Start, "duration", c.Request.Duration, "path", c.Path)
+	if err := p.Transcoder.Cut(c.SourcePath, c.Path, c.Request.Start, c.Request.Duration, progress); err != nil {
+		return &StageError{StageEncode, fmt.Errorf("failed to process and cut video: %w", err)}
+	}
+	return nil
+}
+
+// MessageData builds the template data for the clip's link message. Platform links are
+// only fetched when one of the destinations' templates uses them.
+func (p *Pipeline) MessageData(c *Clip, cfg *config.Config, destinations []config.Destination) MessageData {
+	data := MessageData{
+		Display:         c.Display,
+		Title:           c.Track.Title,
+		Artist:          c.Track.Artist,
+		URL:             c.Request.URL,
+		YoutubeURL:      c.Track.YoutubeURL,
+		Start:           c.Request.Start,
+		DurationSeconds: c.Request.Duration,
+		Hashtags:        append([]string(nil), cfg.Hashtags...),
+	}
+	if tag := toHashtag(c.Track.Artist); tag != "" {
+		data.Hashtags = append(data.Hashtags, tag)
+	}
+	if TemplatesUseLinks(destinations) {
+		links, err := p.Resolver.PlatformLinks(c.Request.URL)
+		if err != nil {
+			c.logger(StagePublish).Warn("Failed to fetch platform links", "err", err)
+		}
+		data.Links = links
+	}
+	return data
+}
+
+type PublishResult struct {
+	Destination   config.Destination
+	MessageText   string
+	LinkMessageID int
+	VideoNote     *telegram.Message
+	Err           error
+}
+
+// Publish posts the link message and video note to each destination in turn.
+// The clip is uploaded once; later destinations reuse the file_id Telegram returned. If fileID
+// is already known, the clip is not uploaded at all. A failure in one destination does not stop
+// the others. Destinations are expected to have gone through ApplyMessageTemplates.
+func (p *Pipeline) Publish(destinations []config.Destination, data MessageData, videoPath, fileID string, length, duration int) []PublishResult {
+	results := make([]PublishResult, 0, len(destinations))
+
+	for _, d := range destinations {
+		result := PublishResult{Destination: d}
+		opts := d.SendOptions()
+
+		messageText, err := RenderMessage(d.MessageTemplate, d.ParseMode, data)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		result.MessageText = messageText
+
+		linkMessage, err := p.Publisher.SendMessage(d.ChatID, messageText, d.ParseMode, true, opts)
+		if err != nil {
+			result.Err = fmt.Errorf("failed to send link message: %w", err)
+			results = append(results, result)
+			continue
+		}
+		result.LinkMessageID = linkMessage.MessageID
+
+		var videoNote *telegram.Message
+		if fileID != "" {
+			videoNote, err = p.Publisher.SendVideoNoteByFileID(d.ChatID, fileID, opts)
+		} else {
+			videoNote, err = p.Publisher.SendVideoNote(d.ChatID, videoPath, length, duration, opts)
+		}
+		if err != nil {
+			result.Err = fmt.Errorf("failed to send video note: %w", err)
+			results = append(results, result)
+			continue
+		}
+		result.VideoNote = videoNote
+		if fileID == "" && videoNote.VideoNote != nil {
+			fileID = videoNote.VideoNote.FileID
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ParseTimestamp parses "80", "1:20" or "1:01:20" into seconds.
+func ParseTimestamp(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	total := 0
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		total = total*60 + n
+	}
+	return total, nil
+}
+
+func FormatDuration(seconds int) string {
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+func sanitizeFilename(s string) string {
+	s = strings.ReplaceAll(s, " ", "_")
+	s = strings.ReplaceAll(s, "/", "_")
+	s = strings.ReplaceAll(s, "\\", "_")
+	s = strings.ReplaceAll(s, ":", "")
+	s = strings.ReplaceAll(s, "*", "")
+	s = strings.ReplaceAll(s, "?", "")
+	s = strings.ReplaceAll(s, "\"", "")
+	s = strings.ReplaceAll(s, "<", "")
+	s = strings.ReplaceAll(s, ">", "")
+	s = strings.ReplaceAll(s, "|", "")
+	return s
+}
@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/resolve"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+type fakeResolver struct {
+	track resolve.TrackInfo
+	links map[string]string
+}
+
+func (r *fakeResolver) Resolve(string, *slog.Logger) resolve.TrackInfo { return r.track }
+
+func (r *fakeResolver) PlatformLinks(string) (map[string]string, error) { return r.links, nil }
+
+type fakeDownloader struct {
+	url string
+	err error
+}
+
+func (d *fakeDownloader) Download(url, path string, progress func(float64)) error {
+	d.url = url
+	if d.err != nil {
+		return d.err
+	}
+	if progress != nil {
+		progress(1)
+	}
+	return os.WriteFile(path, []byte("source"), 0o644)
+}
+
+type fakeTranscoder struct {
+	start, duration int
+	err             error
+}
+
+func (tc *fakeTranscoder) Cut(input, output string, start, duration int, progress func(float64)) error {
+	tc.start, tc.duration = start, duration
+	if tc.err != nil {
+		return tc.err
+	}
+	if _, err := os.Stat(input); err != nil {
+		return err
+	}
+	return os.WriteFile(output, []byte("clip"), 0o644)
+}
+
+// fakePublisher records what it is asked to send. Chats in fail refuse everything.
+type fakePublisher struct {
+	calls  []string
+	fail   map[string]bool
+	nextID int
+}
+
+func (p *fakePublisher) send(call, chatID string) (*telegram.Message, error) {
+	p.calls = append(p.calls, call)
+	if p.fail[chatID] {
+		return nil, fmt.Errorf("chat %s refused", chatID)
+	}
+	p.nextID++
+	return &telegram.Message{MessageID: p.nextID}, nil
+}
+
+func (p *fakePublisher) SendMessage(chatID, text, parseMode string, _ bool, _ telegram.SendOptions) (*telegram.Message, error) {
+	return p.send(fmt.Sprintf("message %s %s %q", chatID, parseMode, text), chatID)
+}
+
+func (p *fakePublisher) SendVideoNote(chatID, videoPath string, length, duration int, _ telegram.SendOptions) (*telegram.Message, error) {
+	m, err := p.send(fmt.Sprintf("upload %s %s %d %d", chatID, filepath.Base(videoPath), length, duration), chatID)
+	if err == nil {
+		m.VideoNote = &telegram.VideoNote{FileID: "file-1"}
+	}
+	return m, err
+}
+
+func (p *fakePublisher) SendVideoNoteByFileID(chatID, fileID string, _ telegram.SendOptions) (*telegram.Message, error) {
+	m, err := p.send(fmt.Sprintf("resend %s %s", chatID, fileID), chatID)
+	if err == nil {
+		m.VideoNote = &telegram.VideoNote{FileID: fileID}
+	}
+	return m, err
+}
+
+func fakePipeline() (*Pipeline, *fakeDownloader, *fakeTranscoder, *fakePublisher) {
+	downloader, transcoder, publisher := &fakeDownloader{}, &fakeTranscoder{}, &fakePublisher{}
+	return &Pipeline{
+		Resolver: &fakeResolver{
+			track: resolve.TrackInfo{Title: "Song", Artist: "The Band", YoutubeURL: "https://www.youtube.com/watch?v=abc"},
+			links: map[string]string{"spotify": "https://open.spotify.com/track/1"},
+		},
+		Downloader: downloader,
+		Transcoder: transcoder,
+		Publisher:  publisher,
+	}, downloader, transcoder, publisher
+}
+
+func TestMake(t *testing.T) {
+	p, downloader, transcoder, _ := fakePipeline()
+	clip, err := p.Make(ClipRequest{URL: "https://song.link/s/1", Start: 60, Duration: 30, WorkDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Make: %v", err)
+	}
+	if clip.Display != `"Song" by The Band` || clip.FilenameBase != "Song_by_The_Band" {
+		t.Errorf("display %q, file name %q", clip.Display, clip.FilenameBase)
+	}
+	if downloader.url != "https://www.youtube.com/watch?v=abc" {
+		t.Errorf("downloaded %q, want the YouTube URL", downloader.url)
+	}
+	if transcoder.start != 60 || transcoder.duration != 30 {
+		t.Errorf("cut %d seconds from %d", transcoder.duration, transcoder.start)
+	}
+	if _, err := os.Stat(clip.Path); err != nil {
+		t.Errorf("no clip: %v", err)
+	}
+}
+
+func TestMakeCustomNames(t *testing.T) {
+	p, _, _, _ := fakePipeline()
+	clip, err := p.Make(ClipRequest{URL: "https://song.link/s/1", Start: 0, Duration: 10, SongName: "Solo", AuthorName: "Guitarist", WorkDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Make: %v", err)
+	}
+	if clip.Display != `"Solo" by Guitarist` || clip.Track.Title != "Solo" || clip.Track.Artist != "Guitarist" {
+		t.Errorf("display %q, track %+v", clip.Display, clip.Track)
+	}
+}
+
+func TestMakeErrorStages(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		setup func(*fakeResolver, *fakeDownloader, *fakeTranscoder)
+		want  Stage
+	}{
+		{"not a link", "song.link/s/1", nil, StageResolve},
+		{"download", "https://song.link/s/1", func(_ *fakeResolver, d *fakeDownloader, _ *fakeTranscoder) {
+			d.err = errors.New("HTTP Error 403")
+		}, StageDownload},
+		{"song link rejected by yt-dlp", "https://song.link/s/1", func(r *fakeResolver, d *fakeDownloader, _ *fakeTranscoder) {
+			r.track.YoutubeURL = ""
+			d.err = errors.New("Unsupported URL")
+		}, StageResolve},
+		{"encode", "https://song.link/s/1", func(_ *fakeResolver, _ *fakeDownloader, tc *fakeTranscoder) {
+			tc.err = errors.New("ffmpeg failed")
+		}, StageEncode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, downloader, transcoder, _ := fakePipeline()
+			if tt.setup != nil {
+				tt.setup(p.Resolver.(*fakeResolver), downloader, transcoder)
+			}
+			_, err := p.Make(ClipRequest{URL: tt.url, Start: 0, Duration: 10, WorkDir: t.TempDir()})
+			if got := ErrorStage(err); got != tt.want {
+				t.Errorf("ErrorStage(%v) = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	p, _, _, publisher := fakePipeline()
+	publisher.fail = map[string]bool{"@broken": true}
+	cfg := &config.Config{ParseMode: telegram.ParseModeHTML}
+	destinations, err := ApplyMessageTemplates([]config.Destination{
+		{Name: "broken", ChatID: "@broken"},
+		{Name: "channel", ChatID: "@channel"},
+		{Name: "group", ChatID: "-100", MessageTemplate: "{{.Title}} {{.Links.spotify}}", ParseMode: telegram.ParseModeMarkdownV2},
+	}, cfg, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip := &Clip{
+		Request: ClipRequest{URL: "https://song.link/s/1", Start: 60, Duration: 30},
+		Track:   resolve.TrackInfo{Title: "Song.", Artist: "The Band"},
+		Display: `"Song." by The Band`,
+	}
+	data := p.MessageData(clip, cfg, destinations)
+
+	results := p.Publish(destinations, data, "/clips/song_cut.mp4", "", VideoNoteLength, 30)
+
+	if len(results) != 3 || results[0].Err == nil || results[1].Err != nil || results[2].Err != nil {
+		t.Fatalf("results: %+v", results)
+	}
+	want := []string{
+		`message @broken HTML "<a href=\"https://song.link/s/1\">&quot;Song.&quot; by The Band</a>"`,
+		`message @channel HTML "<a href=\"https://song.link/s/1\">&quot;Song.&quot; by The Band</a>"`,
+		fmt.Sprintf("upload @channel song_cut.mp4 %d 30", VideoNoteLength),
+		`message -100 MarkdownV2 "Song\\. https://open\\.spotify\\.com/track/1"`,
+		"resend -100 file-1",
+	}
+	if fmt.Sprint(publisher.calls) != fmt.Sprint(want) {
+		t.Errorf("calls:\n%q\nwant:\n%q", publisher.calls, want)
+	}
+}
@@ -0,0 +1,227 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+)
+
+type ClipStatus string
+
+const (
+	ClipQueued      ClipStatus = "queued"
+	ClipResolving   ClipStatus = "resolving"
+	ClipDownloading ClipStatus = "downloading"
+	ClipEncoding    ClipStatus = "encoding"
+	ClipDone        ClipStatus = "done"
+	ClipFailed      ClipStatus = "failed"
+)
+
+// ClipJob is one clip being made by a WorkerPool in its own working directory.
+type ClipJob struct {
+	ID      string
+	Label   string
+	Request ClipRequest
+	WorkDir string
+	// Log carries the job's ID and URL; the clip is logged to it.
+	Log *slog.Logger
+
+	mu       sync.Mutex
+	status   ClipStatus
+	err      error
+	clip     *Clip
+	started  time.Time
+	finished time.Time
+	done     chan struct{}
+}
+
+// Status returns the job's current stage and, once it has failed, the error.
+func (j *ClipJob) Status() (ClipStatus, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status, j.err
+}
+
+// Elapsed is how long the job has been running, or took to finish.
+func (j *ClipJob) Elapsed() time.Duration {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.finished.IsZero() {
+		return time.Since(j.started)
+	}
+	return j.finished.Sub(j.started)
+}
+
+// Clip returns the clip once its track has been resolved, or nil before that. It is only
+// complete once the job is done.
+func (j *ClipJob) Clip() *Clip {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.clip
+}
+
+// Wait blocks until the job has finished and returns its clip.
+func (j *ClipJob) Wait() (*Clip, error) {
+	<-j.done
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.clip, j.err
+}
+
+// WorkerPool makes clips concurrently. Jobs resolve their tracks in parallel, but only a
+// limited number download or encode at once, since both are heavy on bandwidth or CPU.
+type WorkerPool struct {
+	pipeline  *Pipeline
+	baseDir   string
+	downloads chan struct{}
+	encodes   chan struct{}
+
+	// OnStatus, if set, is called from the job's goroutine whenever a job changes stage.
+	OnStatus func(job *ClipJob)
+	// OnProgress, if set, is called from the job's goroutine with how far the download or
+	// encode the job is at has got, from 0 to 1.
+	OnProgress func(job *ClipJob, fraction float64)
+
+	mu   sync.Mutex
+	jobs []*ClipJob
+	wg   sync.WaitGroup
+}
+
+func NewWorkerPool(pipeline *Pipeline, baseDir string, workers config.WorkersConfig) *WorkerPool {
+	downloads, encodes := workers.Limits()
+	return &WorkerPool{
+		pipeline:  pipeline,
+		baseDir:   baseDir,
+		downloads: make(chan struct{}, downloads),
+		encodes:   make(chan struct{}, encodes),
+	}
+}
+
+// Submit creates a fresh working directory under the pool's base directory and starts
+// making the clip in it. The directory is left in place for the caller to remove.
+func (p *WorkerPool) Submit(label string, req ClipRequest) (*ClipJob, error) {
+	if err := os.MkdirAll(p.baseDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create work directory %s: %w", p.baseDir, err)
+	}
+	workDir, err := os.MkdirTemp(p.baseDir, time.Now().Format("20060102-150405-"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	req.WorkDir = workDir
+
+	job := &ClipJob{
+		ID:      filepath.Base(workDir),
+		Label:   label,
+		Request: req,
+		WorkDir: workDir,
+		Log:     slog.Default().With("job", filepath.Base(workDir), "url", req.URL),
+		status:  ClipQueued,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	p.mu.Lock()
+	p.jobs = append(p.jobs, job)
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go p.run(job)
+	return job, nil
+}
+
+// Wait blocks until every submitted job has finished.
+func (p *WorkerPool) Wait() {
+	p.wg.Wait()
+}
+
+// Active returns the jobs that have not finished yet, oldest first.
+func (p *WorkerPool) Active() []*ClipJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.jobs)
+}
+
+// Encode runs fn once an encode slot is free. It is meant for re-cuts outside of a job.
+func (p *WorkerPool) Encode(fn func() error) error {
+	p.encodes <- struct{}{}
+	defer func() { <-p.encodes }()
+	return fn()
+}
+
+func (p *WorkerPool) run(job *ClipJob) {
+	defer p.wg.Done()
+
+	clip, err := p.make(job)
+
+	job.mu.Lock()
+	job.clip, job.err = clip, err
+	job.finished = time.Now()
+	job.mu.Unlock()
+	if err != nil {
+		p.setStatus(job, ClipFailed)
+	} else {
+		p.setStatus(job, ClipDone)
+	}
+
+	p.mu.Lock()
+	p.jobs = slices.DeleteFunc(p.jobs, func(j *ClipJob) bool { return j == job })
+	p.mu.Unlock()
+	close(job.done)
+}
+
+func (p *WorkerPool) make(job *ClipJob) (*Clip, error) {
+	p.setStatus(job, ClipResolving)
+	clip, err := p.pipeline.Prepare(job.Request, job.Log)
+	if err != nil {
+		return nil, err
+	}
+	job.mu.Lock()
+	job.clip = clip
+	job.mu.Unlock()
+
+	p.setStatus(job, ClipQueued)
+	p.downloads <- struct{}{}
+	p.setStatus(job, ClipDownloading)
+	err = p.pipeline.Download(clip, p.progress(job))
+	<-p.downloads
+	if err != nil {
+		return nil, err
+	}
+
+	p.setStatus(job, ClipQueued)
+	if err := p.Encode(func() error {
+		p.setStatus(job, ClipEncoding)
+		return p.pipeline.Cut(clip, p.progress(job))
+	}); err != nil {
+		return nil, err
+	}
+	return clip, nil
+}
+
+// progress returns a callback passing job's progress on to OnProgress, or nil if it is unset.
+func (p *WorkerPool) progress(job *ClipJob) func(float64) {
+	if p.OnProgress == nil {
+		return nil
+	}
+	return func(fraction float64) { p.OnProgress(job, fraction) }
+}
+
+func (p *WorkerPool) setStatus(job *ClipJob, status ClipStatus) {
+	job.mu.Lock()
+	job.status = status
+	err := job.err
+	job.mu.Unlock()
+	if err != nil {
+		job.Log.Debug("Job failed", "stage", ErrorStage(err), "err", err)
+	} else {
+		job.Log.Debug("Job status changed", "status", status)
+	}
+	if p.OnStatus != nil {
+		p.OnStatus(job)
+	}
+}
@@ -0,0 +1,33 @@
+package pipeline
+
+import "errors"
+
+// Stage names a step of turning a song link into a published video note.
+type Stage string
+
+const (
+	StageResolve  Stage = "resolve"
+	StageDownload Stage = "download"
+	StageEncode   Stage = "encode"
+	StagePublish  Stage = "publish"
+)
+
+// StageError is an error from one stage of the pipeline, so callers can tell a link that
+// could not be resolved from a failed download or encode.
+type StageError struct {
+	Stage Stage
+	Err   error
+}
+
+func (e *StageError) Error() string { return e.Err.Error() }
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// ErrorStage returns the stage err comes from, or "" if it is not a StageError.
+func ErrorStage(err error) Stage {
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return stageErr.Stage
+	}
+	return ""
+}
@@ -0,0 +1,452 @@
+// Package resolve looks up track details for song links through song.link.
+package resolve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultBaseURL = "https://song.link"
+	DefaultAPIURL  = "https://api.song.link"
+)
+
+// Resolver fetches track details from song.link.
+type Resolver struct {
+	// Client is used for every request; nil means http.DefaultClient.
+	Client *http.Client
+	// BaseURL serves the oEmbed endpoint and song pages; empty means DefaultBaseURL.
+	// When set, song pages are fetched from it with the song link's path, so a local
+	// server can stand in for song.link.
+	BaseURL string
+	// APIURL serves the links API; empty means DefaultAPIURL.
+	APIURL string
+}
+
+func (r *Resolver) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return http.DefaultClient
+}
+
+func (r *Resolver) baseURL() string {
+	if r.BaseURL != "" {
+		return strings.TrimSuffix(r.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+func (r *Resolver) apiURL() string {
+	if r.APIURL != "" {
+		return strings.TrimSuffix(r.APIURL, "/")
+	}
+	return DefaultAPIURL
+}
+
+// pageURL is where the song.link page for songURL is fetched from.
+func (r *Resolver) pageURL(songURL string) string {
+	if r.BaseURL == "" {
+		return songURL
+	}
+	u, err := url.Parse(songURL)
+	if err != nil {
+		return songURL
+	}
+	return r.baseURL() + u.RequestURI()
+}
+
+// TrackInfo is what song.link tells us about a track.
+type TrackInfo struct {
+	Title      string `json:"title"`
+	Artist     string `json:"artist"`
+	YoutubeURL string `json:"youtube_url"`
+}
+
+// Resolve asks song.link's oEmbed endpoint for the track and falls back to scraping
+// the song.link page when oEmbed leaves the title, artist or YouTube URL unknown. It logs
+// to logger, which should say which link and job it is about; nil means the default logger
+// with the link added.
+func (r *Resolver) Resolve(songURL string, logger *slog.Logger) TrackInfo {
+	if logger == nil {
+		logger = slog.Default().With("url", songURL)
+	}
+	oembedTitle, oembedArtist, oembedYoutubeURL, oembedErr := r.parseSongLink(songURL, logger)
+	if oembedErr != nil {
+		logger.Warn("oEmbed lookup failed, falling back to the song.link page if needed", "err", oembedErr)
+	}
+
+	var finalArtist, finalTitle, finalYoutubeURL string
+
+	finalArtist = strings.TrimSpace(oembedArtist)
+	finalTitle = strings.TrimSpace(oembedTitle)
+	finalYoutubeURL = oembedYoutubeURL
+
+	// 2.
+	if finalYoutubeURL == "" || (finalTitle == "" && finalArtist == "") {
+		logger.Info("oEmbed result is incomplete, parsing the song.link page", "title", finalTitle, "artist", finalArtist, "youtube_url", finalYoutubeURL)
+
+		// parseSongLinkHTML -> rawFullTitle, htmlYoutubeURL
+		rawTextFromHTML, htmlYoutubeURL, htmlErr := r.parseSongLinkHTML(songURL, logger)
+		if htmlErr != nil {
+			logger.Warn("Parsing the song.link page failed too", "err", htmlErr)
+		} else {
+
+			if finalYoutubeURL == "" && htmlYoutubeURL != "" {
+				finalYoutubeURL = htmlYoutubeURL
+				logger.Debug("Using YouTube URL from the song.link page", "youtube_url", finalYoutubeURL)
+			}
+
+			if (finalTitle == "" && finalArtist == "") && rawTextFromHTML != "" {
+				logger.Debug("Parsing the title from the song.link page", "text", rawTextFromHTML)
+				var htmlParsedTitle, htmlParsedArtist string
+				partsBy := strings.SplitN(rawTextFromHTML, " by ", 2)
+				if len(partsBy) == 2 {
+					htmlParsedTitle = strings.TrimSpace(partsBy[0])
+					htmlParsedArtist = strings.TrimSpace(partsBy[1])
+				} else {
+					partsDash := strings.SplitN(rawTextFromHTML, " - ", 2)
+					if len(partsDash) == 2 {
+						htmlParsedArtist = strings.TrimSpace(partsDash[0])
+						htmlParsedTitle = strings.TrimSpace(partsDash[1])
+					} else {
+						htmlParsedTitle = rawTextFromHTML
+					}
+				}
+				if htmlParsedArtist != "" {
+					htmlParsedArtist = strings.TrimSuffix(htmlParsedArtist, " - Topic")
+					htmlParsedArtist = strings.TrimSpace(htmlParsedArtist)
+				}
+
+				if finalTitle == "" && htmlParsedTitle != "" {
+					finalTitle = htmlParsedTitle
+					logger.Debug("Using title from the song.link page", "title", finalTitle)
+				}
+				if finalArtist == "" && htmlParsedArtist != "" {
+					finalArtist = htmlParsedArtist
+					logger.Debug("Using artist from the song.link page", "artist", finalArtist)
+				}
+			}
+		}
+	}
+
+	return TrackInfo{Title: finalTitle, Artist: finalArtist, YoutubeURL: finalYoutubeURL}
+}
+
+type SongLinkOembedResponse struct {
+	Title       string `json:"title"`
+	AuthorName  string `json:"author_name"`
+	ProviderURL string `json:"provider_url"`
+	HTML        string `json:"html"`
+	//  thumbnail_url
+}
+
+func (r *Resolver) parseSongLink(songURL string, logger *slog.Logger) (title, artist, youtubeURL string, err error) {
+	oembedBaseURL := r.baseURL() + "/oembed"
+	params := url.Values{}
+	params.Add("url", songURL)
+	params.Add("format", "json")
+
+	fullOembedURL := oembedBaseURL + "?" + params.Encode()
+	logger.Debug("Fetching oEmbed data", "oembed_url", fullOembedURL)
+
+	resp, httpErr := r.client().Get(fullOembedURL)
+	if httpErr != nil {
+		return "", "", "", fmt.Errorf("failed to fetch oembed data from %s: %w", fullOembedURL, httpErr)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return "", "", "", fmt.Errorf("failed to read oembed response body for %s: %w", songURL, readErr)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", "", fmt.Errorf("oembed request to %s failed with status %d: %s", fullOembedURL, resp.StatusCode, string(bodyBytes))
+	}
+
+	logger.Debug("Got oEmbed response", "status", resp.StatusCode, "body", string(bodyBytes))
+
+	var oembedResp SongLinkOembedResponse
+	if decodeErr := json.NewDecoder(bytes.NewReader(bodyBytes)).Decode(&oembedResp); decodeErr != nil {
+		return "", "", "", fmt.Errorf("failed to decode oembed JSON response for %s: %w. Raw response: %s", songURL, decodeErr, string(bodyBytes))
+	}
+
+	rawOembedTitle := strings.TrimSpace(oembedResp.Title)
+	rawOembedAuthor := strings.TrimSpace(oembedResp.AuthorName)
+
+	if rawOembedAuthor != "" && !strings.EqualFold(rawOembedAuthor, "youtube") && !strings.EqualFold(rawOembedAuthor, "soundcloud") && !strings.EqualFold(rawOembedAuthor, "spotify") && !strings.Contains(rawOembedAuthor, "Topic") {
+		artist = rawOembedAuthor
+		if rawOembedTitle != "" {
+			if strings.Contains(rawOembedTitle, artist) {
+				tempTitle := strings.TrimSpace(strings.ReplaceAll(rawOembedTitle, artist, ""))
+				tempTitle = strings.TrimPrefix(tempTitle, " - ")
+				tempTitle = strings.TrimPrefix(tempTitle, "- ")
+				tempTitle = strings.TrimSuffix(tempTitle, " - ")
+				tempTitle = strings.TrimSuffix(tempTitle, " -")
+				if tempTitle != "" {
+					title = tempTitle
+				} else {
+					title = rawOembedTitle
+				}
+			} else {
+				title = rawOembedTitle
+			}
+		}
+	} else if rawOembedTitle != "" {
+
+		parts := strings.SplitN(rawOembedTitle, " - ", 2)
+		if len(parts) == 2 {
+			artist = strings.TrimSpace(parts[0])
+			title = strings.TrimSpace(parts[1])
+		} else {
+			title = rawOembedTitle
+		}
+	}
+	if artist != "" {
+		artist = strings.TrimSuffix(artist, " - Topic")
+	}
+
+	var extractedYoutubeURL string
+	if oembedResp.HTML != "" {
+		r := regexp.MustCompile(`src="([^"]*youtube\.com[^"]*(?:embed/|watch\?v=)[a-zA-Z0-9_-]+[^"]*)"`)
+		matches := r.FindStringSubmatch(oembedResp.HTML)
+		if len(matches) > 1 {
+			extractedYoutubeURL = matches[1]
+			if strings.Contains(extractedYoutubeURL, "/embed/") {
+				extractedYoutubeURL = strings.Replace(extractedYoutubeURL, "/embed/", "/watch?v=", 1)
+				if qPos := strings.Index(extractedYoutubeURL, "?"); qPos != -1 {
+					urlParts := strings.SplitN(extractedYoutubeURL, "?", 2)
+					if len(urlParts) == 2 {
+						queryParams := strings.Split(urlParts[1], "&")
+						for _, param := range queryParams {
+							if strings.HasPrefix(param, "v=") {
+								extractedYoutubeURL = urlParts[0] + "?" + param
+								break
+							}
+						}
+					}
+				}
+			}
+			logger.Debug("Extracted YouTube URL from the oEmbed HTML", "youtube_url", extractedYoutubeURL)
+		}
+	}
+	if extractedYoutubeURL == "" && oembedResp.ProviderURL != "" && (strings.Contains(oembedResp.ProviderURL, "youtube.com") || strings.Contains(oembedResp.ProviderURL, "youtu.be")) {
+		extractedYoutubeURL = oembedResp.ProviderURL
+		logger.Debug("Using the oEmbed provider URL as YouTube URL", "youtube_url", extractedYoutubeURL)
+	}
+	youtubeURL = extractedYoutubeURL
+
+	if title == "" && artist == "" && youtubeURL == "" && oembedResp.Title == "" {
+		// If nothing was extracted and oEmbed title is empty.
+		// This check ensures parseSongLink returns an error only if oEmbed was completely useless,
+		// so main can fall back to HTML parsing.
+		// But if oEmbed returned anything (e.g., just HTML with a YouTube link), it's not an error.
+		// Errors are already handled for failed oEmbed requests or JSON decoding issues.
+		// Empty title/artist alone are not considered oEmbed errors.
+	}
+
+	logger.Debug("Parsed oEmbed data", "title", title, "artist", artist, "youtube_url", youtubeURL)
+	return title, artist, youtubeURL, nil
+}
+
+func (r *Resolver) parseSongLinkHTML(songURL string, logger *slog.Logger) (rawFullTitle, youtubeURL string, err error) {
+	logger.Debug("Fetching the song.link page", "page_url", r.pageURL(songURL))
+	resp, httpGetErr := r.client().Get(r.pageURL(songURL))
+	if httpGetErr != nil {
+		return "", "", fmt.Errorf("html get failed for %s: %w", songURL, httpGetErr)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return "", "", fmt.Errorf("html failed to read body for %s: %w", songURL, readErr)
+	}
+	bodyString := string(bodyBytes)
+
+	doc, htmlParseErr := html.Parse(strings.NewReader(bodyString))
+	if htmlParseErr != nil {
+		logger.Warn("Failed to parse the song.link page, looking for a YouTube URL in its text", "err", htmlParseErr)
+	} else {
+		// 1. parsing meta tags (og:title, og:video:url)
+		var ogVideoURL string
+		var ogTitleFull string
+
+		var traverseMetaTags func(*html.Node)
+		traverseMetaTags = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "meta" {
+				var property, contentVal string
+				isOgTitle := false
+				isOgVideo := false
+				for _, attr := range n.Attr {
+					if attr.Key == "property" {
+						property = attr.Val
+						if property == "og:title" {
+							isOgTitle = true
+						} else if property == "og:video:url" || property == "og:video:secure_url" {
+							isOgVideo = true
+						}
+					}
+					if attr.Key == "content" {
+						contentVal = attr.Val
+					}
+				}
+				if isOgTitle && contentVal != "" {
+					ogTitleFull = contentVal
+				}
+				if isOgVideo && contentVal != "" && (strings.Contains(contentVal, "youtube.com") || strings.Contains(contentVal, "youtu.be")) {
+					ogVideoURL = contentVal
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				traverseMetaTags(c)
+			}
+		}
+		traverseMetaTags(doc)
+
+		if ogVideoURL != "" {
+			youtubeURL = ogVideoURL
+		}
+		if ogTitleFull != "" {
+			rawFullTitle = ogTitleFull
+		}
+
+		// 2. If og:title gave no info (rawFullTitle is empty), try to find a specific DIV structure
+		if rawFullTitle == "" && doc != nil {
+			logger.Debug("No og:title on the song.link page, looking for the title elements")
+
+			var divTitle, divArtist string
+			var findSpecificDivs func(*html.Node) bool
+
+			findSpecificDivs = func(n *html.Node) bool {
+				if n.Type == html.ElementNode && n.Data == "div" {
+					var classValue string
+					for _, attr := range n.Attr {
+						if attr.Key == "class" {
+							classValue = attr.Val
+							break
+						}
+					}
+					if strings.Contains(classValue, "e12n0mv62") {
+						for c := n.FirstChild; c != nil; c = c.NextSibling {
+							if c.Type == html.ElementNode && c.Data == "div" {
+								var childClassValue string
+								for _, attrChild := range c.Attr {
+									if attrChild.Key == "class" {
+										childClassValue = attrChild.Val
+										break
+									}
+								}
+								if divTitle == "" && strings.Contains(childClassValue, "e12n0mv61") {
+									divTitle = extractTextFromNode(c)
+								}
+								if divArtist == "" && strings.Contains(childClassValue, "e12n0mv60") {
+									divArtist = extractTextFromNode(c)
+								}
+							}
+						}
+						if divTitle != "" && divArtist != "" {
+							rawFullTitle = fmt.Sprintf("%s by %s", divTitle, divArtist)
+							logger.Debug("Found title and artist in the title elements", "text", rawFullTitle)
+							return true
+						} else if divTitle != "" {
+							rawFullTitle = divTitle
+							logger.Debug("Found only the title in the title elements", "text", rawFullTitle)
+							return true
+						}
+					}
+				}
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					if findSpecificDivs(c) {
+						return true
+					}
+				}
+				return false
+			}
+			findSpecificDivs(doc)
+		}
+	}
+
+	// 3. YouTube URL from regex if not found earlier
+	if youtubeURL == "" {
+		ytRegex := regexp.MustCompile(`https?://(?:www\.)?(?:youtube\.com/watch\?v=|youtu\.be/)[a-zA-Z0-9_-]{11}`)
+		match := ytRegex.FindString(bodyString)
+		if match != "" {
+			youtubeURL = match
+			logger.Debug("Found a YouTube URL in the page text", "youtube_url", youtubeURL)
+		}
+	}
+
+	if rawFullTitle == "" && youtubeURL == "" {
+		return "", "", fmt.Errorf("could not extract any useful data from HTML for %s", songURL)
+	}
+
+	logger.Debug("Parsed the song.link page", "text", rawFullTitle, "youtube_url", youtubeURL)
+	return rawFullTitle, youtubeURL, nil
+}
+
+func extractTextFromNode(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	if n.Type == html.TextNode {
+		return strings.TrimSpace(n.Data)
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		text := extractTextFromNode(c)
+		if text != "" {
+			if sb.Len() > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(text)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+type songLinkLinksResponse struct {
+	LinksByPlatform map[string]struct {
+		URL string `json:"url"`
+	} `json:"linksByPlatform"`
+}
+
+// PlatformLinks asks the song.link API for the track's URL on each streaming platform.
+func (r *Resolver) PlatformLinks(songURL string) (map[string]string, error) {
+	params := url.Values{}
+	params.Add("url", songURL)
+	apiURL := r.apiURL() + "/v1-alpha.1/links?" + params.Encode()
+
+	resp, err := r.client().Get(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch platform links for %s: %w", songURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("song.link API request for %s failed with status %d: %s", songURL, resp.StatusCode, string(respBody))
+	}
+
+	var linksResp songLinkLinksResponse
+	if err := json.NewDecoder(resp.Body).Decode(&linksResp); err != nil {
+		return nil, fmt.Errorf("failed to decode song.link API response for %s: %w", songURL, err)
+	}
+
+	links := make(map[string]string, len(linksResp.LinksByPlatform))
+	for platform, link := range linksResp.LinksByPlatform {
+		if link.URL != "" {
+			links[platform] = link.URL
+		}
+	}
+	return links, nil
+}
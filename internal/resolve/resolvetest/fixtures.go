@@ -0,0 +1,189 @@
+// Package resolvetest replays recorded song.link responses from a local server, so the
+// oEmbed and HTML parsing heuristics can be checked against known pages without a network.
+//
+// Each fixture is a directory holding fixture.json with the song link and the expected
+// TrackInfo, plus the recorded oembed.json and page.html. A missing response file is
+// served as 404, which exercises the fallbacks.
+package resolvetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Ma11doror/tgCircleGen/internal/resolve"
+)
+
+// DefaultDir is where the fixtures live, relative to the repository root.
+const DefaultDir = "internal/resolve/testdata/songlink"
+
+const (
+	fixtureFile = "fixture.json"
+	oembedFile  = "oembed.json"
+	pageFile    = "page.html"
+)
+
+// Fixture is one recorded song link.
+type Fixture struct {
+	Name     string            `json:"-"`
+	Dir      string            `json:"-"`
+	URL      string            `json:"url"`
+	Expected resolve.TrackInfo `json:"expected"`
+}
+
+// Load reads every fixture in dir, sorted by name.
+func Load(dir string) ([]*Fixture, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []*Fixture
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		fixture, err := LoadFixture(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	slices.SortFunc(fixtures, func(a, b *Fixture) int { return strings.Compare(a.Name, b.Name) })
+	return fixtures, nil
+}
+
+// LoadFixture reads the fixture in dir.
+func LoadFixture(dir string) (*Fixture, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fixtureFile))
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filepath.Join(dir, fixtureFile), err)
+	}
+	if fixture.URL == "" {
+		return nil, fmt.Errorf("%s has no url", filepath.Join(dir, fixtureFile))
+	}
+	fixture.Name = filepath.Base(dir)
+	fixture.Dir = dir
+	return &fixture, nil
+}
+
+// Save writes fixture.json.
+func (f *Fixture) Save() error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(f.Dir, fixtureFile), append(data, '\n'), 0644)
+}
+
+// Serve starts a local server answering the oEmbed endpoint and the song page with the
+// recorded responses. Close it when done.
+func (f *Fixture) Serve() (*httptest.Server, error) {
+	songURL, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: invalid url: %w", f.Name, err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oembed" && r.URL.Query().Get("url") == f.URL:
+			f.serveFile(w, oembedFile, "application/json")
+		case r.URL.Path == songURL.Path && r.URL.RawQuery == songURL.RawQuery:
+			f.serveFile(w, pageFile, "text/html; charset=utf-8")
+		default:
+			http.NotFound(w, r)
+		}
+	})), nil
+}
+
+func (f *Fixture) serveFile(w http.ResponseWriter, name, contentType string) {
+	data, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+// Resolve runs the resolver against the fixture's recorded responses.
+func (f *Fixture) Resolve() (resolve.TrackInfo, error) {
+	srv, err := f.Serve()
+	if err != nil {
+		return resolve.TrackInfo{}, err
+	}
+	defer srv.Close()
+	r := &resolve.Resolver{Client: srv.Client(), BaseURL: srv.URL}
+	return r.Resolve(f.URL, nil), nil
+}
+
+// Check resolves the fixture and describes every field that differs from the expected
+// TrackInfo; an empty result means it passed.
+func (f *Fixture) Check() ([]string, error) {
+	got, err := f.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	var diffs []string
+	compare := func(field, want, got string) {
+		if want != got {
+			diffs = append(diffs, fmt.Sprintf("%s: want %q, got %q", field, want, got))
+		}
+	}
+	compare("title", f.Expected.Title, got.Title)
+	compare("artist", f.Expected.Artist, got.Artist)
+	compare("youtube_url", f.Expected.YoutubeURL, got.YoutubeURL)
+	return diffs, nil
+}
+
+// Record fetches the live oEmbed response and song page for the fixture's URL from
+// song.link and stores them, replacing earlier recordings. Responses other than 200 OK
+// are not stored, so the fixture replays them as 404.
+func (f *Fixture) Record(client *http.Client) error {
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Add("url", f.URL)
+	params.Add("format", "json")
+	if err := record(client, resolve.DefaultBaseURL+"/oembed?"+params.Encode(), filepath.Join(f.Dir, oembedFile)); err != nil {
+		return fmt.Errorf("failed to record oEmbed response: %w", err)
+	}
+	if err := record(client, f.URL, filepath.Join(f.Dir, pageFile)); err != nil {
+		return fmt.Errorf("failed to record song page: %w", err)
+	}
+	return nil
+}
+
+func record(client *http.Client, fetchURL, path string) error {
+	resp, err := client.Get(fetchURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
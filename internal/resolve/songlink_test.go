@@ -0,0 +1,31 @@
+package resolve_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Ma11doror/tgCircleGen/internal/resolve/resolvetest"
+)
+
+// TestSongLinkFixtures replays every recorded song link, as "fixtures check" does. Record
+// and refresh them with "fixtures record".
+func TestSongLinkFixtures(t *testing.T) {
+	fixtures, err := resolvetest.Load(filepath.Join("testdata", "songlink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no song.link fixtures")
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.Name, func(t *testing.T) {
+			diffs, err := fixture.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, diff := range diffs {
+				t.Errorf("%s: %s", fixture.URL, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+// Package telegram is a small client for the parts of the Telegram Bot API this tool uses.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultAPIURL is the official Bot API server.
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Client calls the Bot API on behalf of one bot.
+type Client struct {
+	Token string
+	// BaseURL is the Bot API server, such as a self-hosted telegram-bot-api or a fake one;
+	// empty means DefaultAPIURL.
+	BaseURL string
+	// HTTPClient is used for every request; nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{Token: token}
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) methodURL(method string) string {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	return fmt.Sprintf("%s/bot%s/%s", strings.TrimSuffix(baseURL, "/"), c.Token, method)
+}
+
+// SendOptions are the per-chat delivery settings shared by all send methods.
+type SendOptions struct {
+	MessageThreadID     int
+	DisableNotification bool
+	ReplyToMessageID    int
+	// ReplyMarkup is an *InlineKeyboardMarkup or a *ForceReply.
+	ReplyMarkup any
+}
+
+// Apply passes the options to set as Bot API parameters.
+func (o SendOptions) Apply(set func(key, value string)) {
+	if o.MessageThreadID != 0 {
+		set("message_thread_id", strconv.Itoa(o.MessageThreadID))
+	}
+	if o.DisableNotification {
+		set("disable_notification", "true")
+	}
+	if o.ReplyToMessageID != 0 {
+		set("reply_parameters", fmt.Sprintf(`{"message_id":%d}`, o.ReplyToMessageID))
+	}
+	if o.ReplyMarkup != nil {
+		markup, _ := json.Marshal(o.ReplyMarkup)
+		set("reply_markup", string(markup))
+	}
+}
+
+// decodeResult reads a Bot API response and decodes its result into result, if non-nil.
+func decodeResult(method string, resp *http.Response, result any) error {
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("telegram API error on %s: %s (status code: %d)", method, string(respBody), resp.StatusCode)
+	}
+
+	var apiResp response
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("telegram API error on %s: %s (error code: %d)", method, apiResp.Description, apiResp.ErrorCode)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(apiResp.Result, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// decodeMessage reads a Bot API response whose result is a Message.
+func decodeMessage(method string, resp *http.Response) (*Message, error) {
+	var message Message
+	if err := decodeResult(method, resp, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// Call posts form parameters to a Bot API method without files.
+func (c *Client) Call(ctx context.Context, method string, params url.Values, result any) error {
+	apiURL := c.methodURL(method)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	return decodeResult(method, resp, result)
+}
+
+func (c *Client) SendMessage(chatID, text, parseMode string, disablePreview bool, opts SendOptions) (*Message, error) {
+	apiURL := c.methodURL("sendMessage")
+
+	params := url.Values{}
+	params.Add("chat_id", chatID)
+	params.Add("text", text)
+	if parseMode != "" {
+		params.Add("parse_mode", parseMode)
+	}
+	if disablePreview {
+		params.Add("disable_web_page_preview", "true")
+	}
+	opts.Apply(params.Add)
+
+	// Using http.PostForm for simplicity since there are no files
+	resp, err := c.client().PostForm(apiURL, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeMessage("sendMessage", resp)
+}
+
+func (c *Client) SendVideoNote(chatID, videoPath string, length int, duration int, opts SendOptions) (*Message, error) {
+	fields := map[string]string{
+		"chat_id":  chatID,
+		"length":   strconv.Itoa(length),
+		"duration": strconv.Itoa(duration),
+	}
+	return c.sendMultipart("sendVideoNote", fields, "video_note", videoPath, opts)
+}
+
+// SendVideo sends a clip as a regular video. Unlike video notes, video messages can later
+// be replaced in place with editMessageMedia.
+func (c *Client) SendVideo(chatID, videoPath, caption string, size, duration int, opts SendOptions) (*Message, error) {
+	fields := map[string]string{
+		"chat_id":            chatID,
+		"caption":            caption,
+		"width":              strconv.Itoa(size),
+		"height":             strconv.Itoa(size),
+		"duration":           strconv.Itoa(duration),
+		"supports_streaming": "true",
+	}
+	return c.sendMultipart("sendVideo", fields, "video", videoPath, opts)
+}
+
+type inputMediaVideo struct {
+	Type              string `json:"type"`
+	Media             string `json:"media"`
+	Caption           string `json:"caption,omitempty"`
+	Width             int    `json:"width,omitempty"`
+	Height            int    `json:"height,omitempty"`
+	Duration          int    `json:"duration,omitempty"`
+	SupportsStreaming bool   `json:"supports_streaming,omitempty"`
+}
+
+// EditMessageVideo replaces the video of a message sent with sendVideo by a newly uploaded file.
+func (c *Client) EditMessageVideo(chatID string, messageID int, videoPath, caption string, size, duration int, opts SendOptions) (*Message, error) {
+	media, err := json.Marshal(inputMediaVideo{
+		Type:              "video",
+		Media:             "attach://video",
+		Caption:           caption,
+		Width:             size,
+		Height:            size,
+		Duration:          duration,
+		SupportsStreaming: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		"chat_id":    chatID,
+		"message_id": strconv.Itoa(messageID),
+		"media":      string(media),
+	}
+	return c.sendMultipart("editMessageMedia", fields, "video", videoPath, opts)
+}
+
+// sendMultipart uploads the file at filePath as fileField together with fields to a Bot API
+// method whose result is a Message.
+func (c *Client) sendMultipart(method string, fields map[string]string, fileField, filePath string, opts SendOptions) (*Message, error) {
+	apiURL := c.methodURL(method)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for key, value := range fields {
+		_ = writer.WriteField(key, value)
+	}
+	opts.Apply(func(key, value string) { _ = writer.WriteField(key, value) })
+
+	part, err := writer.CreateFormFile(fileField, filepath.Base(filePath))
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(part, file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeMessage(method, resp)
+}
+
+// SendVideoNoteByFileID resends a video note that is already stored on Telegram's servers.
+func (c *Client) SendVideoNoteByFileID(chatID, fileID string, opts SendOptions) (*Message, error) {
+	apiURL := c.methodURL("sendVideoNote")
+
+	params := url.Values{}
+	params.Add("chat_id", chatID)
+	params.Add("video_note", fileID)
+	opts.Apply(params.Add)
+
+	resp, err := c.client().PostForm(apiURL, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send video note: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeMessage("sendVideoNote", resp)
+}
+
+// GetMe returns the bot the token belongs to, which also checks that the token is valid.
+func (c *Client) GetMe(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.Call(ctx, "getMe", url.Values{}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetChat returns a chat by numeric ID or @username. It fails if the bot cannot see the chat.
+func (c *Client) GetChat(ctx context.Context, chatID string) (*Chat, error) {
+	params := url.Values{}
+	params.Add("chat_id", chatID)
+	var chat Chat
+	if err := c.Call(ctx, "getChat", params, &chat); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
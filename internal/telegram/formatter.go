@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeHTML       = "HTML"
+)
+
+// Formatter produces Telegram message markup for one parse_mode.
+// Text and URL escape raw strings; the remaining methods take text that is already escaped.
+type Formatter interface {
+	ParseMode() string
+	Text(s string) string
+	URL(u string) string
+	Link(text, url string) string
+	Bold(text string) string
+	Italic(text string) string
+}
+
+// FormatterFor returns the Formatter for a Bot API parse_mode.
+func FormatterFor(parseMode string) (Formatter, error) {
+	switch parseMode {
+	case ParseModeMarkdownV2:
+		return markdownV2Formatter{}, nil
+	case ParseModeHTML:
+		return htmlFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported parse_mode %q (expected %s or %s)", parseMode, ParseModeMarkdownV2, ParseModeHTML)
+	}
+}
+
+// MarkdownV2 requires a backslash before every special character in text, including
+// the backslash itself. Inside the (...) part of a link only ')' and '\' are escaped.
+var (
+	markdownV2Replacer = strings.NewReplacer(
+		"\\", "\\\\",
+		"_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+		"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-",
+		"=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+	)
+	markdownV2URLReplacer = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+)
+
+type markdownV2Formatter struct{}
+
+func (markdownV2Formatter) ParseMode() string { return ParseModeMarkdownV2 }
+
+func (markdownV2Formatter) Text(s string) string { return markdownV2Replacer.Replace(s) }
+
+func (markdownV2Formatter) URL(u string) string { return markdownV2URLReplacer.Replace(u) }
+
+func (f markdownV2Formatter) Link(text, url string) string {
+	return "[" + text + "](" + f.URL(url) + ")"
+}
+
+func (markdownV2Formatter) Bold(text string) string { return "*" + text + "*" }
+
+func (markdownV2Formatter) Italic(text string) string { return "_" + text + "_" }
+
+// Telegram's HTML understands only &lt; &gt; &amp; &quot; and numeric entities.
+var htmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+type htmlFormatter struct{}
+
+func (htmlFormatter) ParseMode() string { return ParseModeHTML }
+
+func (htmlFormatter) Text(s string) string { return htmlReplacer.Replace(s) }
+
+func (htmlFormatter) URL(u string) string { return htmlReplacer.Replace(u) }
+
+func (f htmlFormatter) Link(text, url string) string {
+	return `<a href="` + f.URL(url) + `">` + text + "</a>"
+}
+
+func (htmlFormatter) Bold(text string) string { return "<b>" + text + "</b>" }
+
+func (htmlFormatter) Italic(text string) string { return "<i>" + text + "</i>" }
@@ -0,0 +1,185 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownV2Text(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "Song", "Song"},
+		{"emoji", "🔥 Fire 🎶", "🔥 Fire 🎶"},
+		{"flag emoji", "🇺🇦 Anthem", "🇺🇦 Anthem"},
+		{"brackets", "Song (Live) [Remastered] {Edit}", `Song \(Live\) \[Remastered\] \{Edit\}`},
+		{"backslashes", `AC\DC \\ Back`, `AC\\DC \\\\ Back`},
+		{"rtl", "أغنية - فنان", `أغنية \- فنان`},
+		{"rtl mark", "‏שיר (רמיקס)", "‏שיר \\(רמיקס\\)"},
+		{"every special", "_*[]()~`>#+-=|{}.!", "\\_\\*\\[\\]\\(\\)\\~\\`\\>\\#\\+\\-\\=\\|\\{\\}\\.\\!"},
+		{"quote", `"Song" by Artist`, `"Song" by Artist`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (markdownV2Formatter{}).Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownV2Link(t *testing.T) {
+	tests := []struct {
+		name, text, url, want string
+	}{
+		{"plain", "Song", "https://song.link/s/1", "[Song](https://song.link/s/1)"},
+		{"paren in url", "Song", "https://example.com/a_(b)", `[Song](https://example.com/a_(b\))`},
+		{"backslash in url", "Song", `https://example.com/a\b`, `[Song](https://example.com/a\\b)`},
+		{"special text", "Song (Live)", "https://song.link/s/1", `[Song \(Live\)](https://song.link/s/1)`},
+	}
+	f := markdownV2Formatter{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Link(f.Text(tt.text), tt.url); got != tt.want {
+				t.Errorf("Link(%q, %q) = %q, want %q", tt.text, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLText(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "Song", "Song"},
+		{"emoji", "🔥 Fire 🎶", "🔥 Fire 🎶"},
+		{"brackets", "Song (Live) [Remastered] <Edit>", "Song (Live) [Remastered] &lt;Edit&gt;"},
+		{"backslashes", `AC\DC \\ Back`, `AC\DC \\ Back`},
+		{"rtl", "أغنية & فنان", "أغنية &amp; فنان"},
+		{"quote", `"Song" by Artist`, "&quot;Song&quot; by Artist"},
+		{"entity", "&amp;", "&amp;amp;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (htmlFormatter{}).Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLLink(t *testing.T) {
+	f := htmlFormatter{}
+	got := f.Link(f.Text("Song <Live>"), `https://example.com/?a=1&b="2"`)
+	want := `<a href="https://example.com/?a=1&amp;b=&quot;2&quot;">Song &lt;Live&gt;</a>`
+	if got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+}
+
+func TestFormatterFor(t *testing.T) {
+	for _, mode := range []string{ParseModeMarkdownV2, ParseModeHTML} {
+		f, err := FormatterFor(mode)
+		if err != nil {
+			t.Fatalf("FormatterFor(%q): %v", mode, err)
+		}
+		if f.ParseMode() != mode {
+			t.Errorf("FormatterFor(%q).ParseMode() = %q", mode, f.ParseMode())
+		}
+	}
+	if _, err := FormatterFor("Markdown"); err == nil {
+		t.Error("FormatterFor(\"Markdown\") succeeded, want an error")
+	}
+}
+
+var fuzzSeeds = []string{
+	"Song",
+	"🔥 Fire 🎶",
+	"Song (Live) [Remastered]",
+	`AC\DC \\`,
+	"أغنية - فنان",
+	"‏שיר (רמיקס)",
+	"_*[]()~`>#+-=|{}.!",
+	`<b>"&amp;"</b>`,
+	"https://example.com/a_(b)",
+}
+
+// unescapeMarkdownV2 undoes escaping with the given special characters and reports whether
+// every special character in s was escaped and every backslash escapes one of them.
+func unescapeMarkdownV2(s, special string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' {
+			if i+1 == len(s) || !strings.ContainsRune(special+`\`, rune(s[i+1])) {
+				return "", false
+			}
+			i++
+			b.WriteByte(s[i])
+			continue
+		}
+		if strings.ContainsRune(special, rune(c)) {
+			return "", false
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), true
+}
+
+func FuzzEscapeMarkdownV2(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		fm := markdownV2Formatter{}
+		text := fm.Text(s)
+		got, ok := unescapeMarkdownV2(text, "_*[]()~`>#+-=|{}.!")
+		if !ok {
+			t.Fatalf("Text(%q) = %q has an unescaped special character", s, text)
+		}
+		if got != s {
+			t.Fatalf("Text(%q) = %q unescapes to %q", s, text, got)
+		}
+
+		url := fm.URL(s)
+		got, ok = unescapeMarkdownV2(url, ")")
+		if !ok {
+			t.Fatalf("URL(%q) = %q has an unescaped ')' or '\\'", s, url)
+		}
+		if got != s {
+			t.Fatalf("URL(%q) = %q unescapes to %q", s, url, got)
+		}
+	})
+}
+
+var htmlUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&amp;", "&")
+
+func FuzzEscapeHTML(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		text := (htmlFormatter{}).Text(s)
+		if strings.ContainsAny(text, `<>"`) {
+			t.Fatalf("Text(%q) = %q has an unescaped special character", s, text)
+		}
+		for i := strings.IndexByte(text, '&'); i >= 0; i = nextAmpersand(text, i) {
+			rest := text[i:]
+			if !strings.HasPrefix(rest, "&amp;") && !strings.HasPrefix(rest, "&lt;") &&
+				!strings.HasPrefix(rest, "&gt;") && !strings.HasPrefix(rest, "&quot;") {
+				t.Fatalf("Text(%q) = %q has an unescaped '&'", s, text)
+			}
+		}
+		if got := htmlUnescaper.Replace(text); got != s {
+			t.Fatalf("Text(%q) = %q unescapes to %q", s, text, got)
+		}
+	})
+}
+
+func nextAmpersand(s string, i int) int {
+	j := strings.IndexByte(s[i+1:], '&')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
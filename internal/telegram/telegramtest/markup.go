@@ -0,0 +1,194 @@
+package telegramtest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+// CheckMarkup reports the first problem Telegram would find in text sent with parseMode.
+// An empty parseMode means plain text, which is always accepted.
+func CheckMarkup(text, parseMode string) error {
+	switch parseMode {
+	case "":
+		return nil
+	case telegram.ParseModeMarkdownV2:
+		return checkMarkdownV2(text)
+	case telegram.ParseModeHTML:
+		return checkHTML(text)
+	default:
+		return fmt.Errorf("unsupported parse_mode %q", parseMode)
+	}
+}
+
+// markdownV2Reserved must be escaped with a backslash wherever they don't start or end an entity.
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!"
+
+type openEntity struct {
+	marker string
+	offset int
+}
+
+// checkMarkdownV2 follows Telegram's MarkdownV2 rules: every reserved character outside
+// entity markers is escaped, every entity is closed, and link URLs end with an unescaped ')'.
+func checkMarkdownV2(text string) error {
+	var open []openEntity
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(text) {
+				return fmt.Errorf("can't find end of the escape sequence at byte offset %d", i)
+			}
+			i++
+		case c == '*' || c == '_' || c == '~' || (c == '|' && strings.HasPrefix(text[i:], "||")):
+			marker := string(c)
+			if c == '|' {
+				marker = "||"
+			} else if c == '_' && strings.HasPrefix(text[i:], "__") {
+				marker = "__"
+			}
+			if n := len(open); n > 0 && open[n-1].marker == marker {
+				open = open[:n-1]
+			} else {
+				open = append(open, openEntity{marker: marker, offset: i})
+			}
+			i += len(marker) - 1
+		case c == '`':
+			end, err := skipMarkdownV2Code(text, i)
+			if err != nil {
+				return err
+			}
+			i = end
+		case c == '[':
+			open = append(open, openEntity{marker: "[", offset: i})
+		case c == ']':
+			n := len(open)
+			if n == 0 || open[n-1].marker != "[" {
+				return fmt.Errorf("character ']' is reserved and must be escaped with the preceding '\\'")
+			}
+			start := open[n-1].offset
+			open = open[:n-1]
+			if i+1 >= len(text) || text[i+1] != '(' {
+				return fmt.Errorf("can't find end of the entity starting at byte offset %d", start)
+			}
+			end, err := skipMarkdownV2URL(text, i+2)
+			if err != nil {
+				return err
+			}
+			i = end
+		case strings.IndexByte(markdownV2Reserved, c) >= 0:
+			return fmt.Errorf("character '%c' is reserved and must be escaped with the preceding '\\'", c)
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("can't find end of the entity starting at byte offset %d", open[len(open)-1].offset)
+	}
+	return nil
+}
+
+// skipMarkdownV2Code returns the offset of the last backtick of the inline code or pre block
+// starting at start.
+func skipMarkdownV2Code(text string, start int) (int, error) {
+	fence := "`"
+	if strings.HasPrefix(text[start:], "```") {
+		fence = "```"
+	}
+	for i := start + len(fence); i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(text[i:], fence) {
+			return i + len(fence) - 1, nil
+		}
+	}
+	return 0, fmt.Errorf("can't find end of the entity starting at byte offset %d", start)
+}
+
+// skipMarkdownV2URL returns the offset of the unescaped ')' ending the link URL at start.
+func skipMarkdownV2URL(text string, start int) (int, error) {
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case ')':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("can't find end of a URL at byte offset %d", start-1)
+}
+
+// htmlTags are the tags Telegram's HTML parse mode understands.
+var htmlTags = map[string]bool{
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+	"s": true, "strike": true, "del": true, "span": true, "tg-spoiler": true,
+	"a": true, "code": true, "pre": true, "blockquote": true, "tg-emoji": true,
+}
+
+// checkHTML checks that every tag is supported and properly nested and that every
+// character reference is one Telegram decodes.
+func checkHTML(text string) error {
+	var open []openEntity
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				return fmt.Errorf("unclosed start tag at byte offset %d", i)
+			}
+			tag := text[i+1 : i+end]
+			if name, ok := strings.CutPrefix(tag, "/"); ok {
+				name = strings.TrimSpace(name)
+				n := len(open)
+				if n == 0 || open[n-1].marker != name {
+					return fmt.Errorf("unmatched end tag at byte offset %d, expected \"</%s>\", found \"</%s>\"", i, lastMarker(open), name)
+				}
+				open = open[:n-1]
+			} else {
+				name, _, _ := strings.Cut(tag, " ")
+				if !htmlTags[name] {
+					return fmt.Errorf("unsupported start tag \"%s\" at byte offset %d", name, i)
+				}
+				if name == "a" && !strings.Contains(tag, "href=") {
+					return fmt.Errorf("tag \"a\" must have attribute \"href\" at byte offset %d", i)
+				}
+				open = append(open, openEntity{marker: name, offset: i})
+			}
+			i += end
+		case '&':
+			end := strings.IndexByte(text[i:], ';')
+			if end < 0 || !isHTMLEntity(text[i+1:i+end]) {
+				return fmt.Errorf("unsupported HTML entity at byte offset %d", i)
+			}
+			i += end
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("can't find end tag corresponding to start tag \"%s\"", lastMarker(open))
+	}
+	return nil
+}
+
+func lastMarker(open []openEntity) string {
+	if len(open) == 0 {
+		return ""
+	}
+	return open[len(open)-1].marker
+}
+
+func isHTMLEntity(name string) bool {
+	switch name {
+	case "lt", "gt", "amp", "quot":
+		return true
+	}
+	digits, ok := strings.CutPrefix(name, "#")
+	if !ok || digits == "" {
+		return false
+	}
+	if hex, ok := strings.CutPrefix(strings.ToLower(digits), "x"); ok {
+		return hex != "" && strings.Trim(hex, "0123456789abcdef") == ""
+	}
+	return strings.Trim(digits, "0123456789") == ""
+}
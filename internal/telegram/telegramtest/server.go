@@ -0,0 +1,522 @@
+// Package telegramtest is a fake Telegram Bot API server. It records every call, checks the
+// fields and message markup the way Telegram would, and can be told to fail, so the bot
+// and the publishing pipeline can run end to end without a network or a real bot.
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+// videoNoteFileIDPrefix starts the file_id of every video note uploaded to the server.
+const videoNoteFileIDPrefix = "fake-video-note-"
+
+// maxUploadSize mirrors the 50 MB upload limit of the official Bot API server.
+const maxUploadSize = 50 << 20
+
+// File is an uploaded multipart file.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Request is one recorded Bot API call.
+type Request struct {
+	Method string
+	// Params holds the form values, or the non-file fields of a multipart upload.
+	Params url.Values
+	Files  map[string]File
+	// Err is the error returned to the client, if the call was rejected or failed on purpose.
+	Err  string
+	Time time.Time
+}
+
+type failure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// Server is a fake Bot API for one bot token.
+type Server struct {
+	URL   string
+	Token string
+
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	requests      []Request
+	failures      map[string][]failure
+	updates       []telegram.Update
+	nextMessageID int
+	nextFileID    int
+}
+
+// NewServer starts a fake Bot API accepting token. Close it when done.
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:    token,
+		failures: make(map[string][]failure),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a Bot API client pointed at the fake server.
+func (s *Server) Client() *telegram.Client {
+	tg := telegram.NewClient(s.Token)
+	tg.BaseURL = s.URL
+	return tg
+}
+
+// Requests returns the recorded calls to method, or all calls if method is empty.
+func (s *Server) Requests(method string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var requests []Request
+	for _, r := range s.requests {
+		if method == "" || r.Method == method {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// Reset forgets the recorded calls, pending failures and updates.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.failures = make(map[string][]failure)
+	s.updates = nil
+}
+
+// FailNext makes the next call to method fail with an HTTP and Bot API error code, such as
+// 500 or 400. Calls to FailNext queue up, so several calls fail in turn.
+func (s *Server) FailNext(method string, code int, description string) {
+	if description == "" {
+		description = http.StatusText(code)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{code: code, description: description})
+}
+
+// RateLimitNext makes the next call to method fail with 429 Too Many Requests, asking the
+// client to wait retryAfter seconds.
+func (s *Server) RateLimitNext(method string, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{
+		code:        http.StatusTooManyRequests,
+		description: fmt.Sprintf("Too Many Requests: retry after %d", retryAfter),
+		retryAfter:  retryAfter,
+	})
+}
+
+// QueueUpdate adds an update for getUpdates to return. Update IDs are assigned in order
+// if left zero.
+func (s *Server) QueueUpdate(update telegram.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if update.UpdateID == 0 {
+		update.UpdateID = len(s.updates) + 1
+	}
+	s.updates = append(s.updates, update)
+}
+
+type apiResponse struct {
+	OK          bool                `json:"ok"`
+	Result      any                 `json:"result,omitempty"`
+	Description string              `json:"description,omitempty"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Parameters  *responseParameters `json:"parameters,omitempty"`
+}
+
+type responseParameters struct {
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// apiError is a rejected call, reported with Telegram's status code and description.
+type apiError struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+func (e *apiError) Error() string {
+	return e.description
+}
+
+func badRequest(format string, args ...any) *apiError {
+	return &apiError{code: http.StatusBadRequest, description: "Bad Request: " + fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || !strings.HasPrefix(r.URL.Path, "/bot") {
+		writeResponse(w, &apiError{code: http.StatusNotFound, description: "Not Found"}, nil)
+		return
+	}
+	if token != s.Token {
+		writeResponse(w, &apiError{code: http.StatusUnauthorized, description: "Unauthorized"}, nil)
+		return
+	}
+
+	req := Request{Method: method, Files: make(map[string]File), Time: time.Now()}
+	params, err := readParams(r, req.Files)
+	req.Params = params
+
+	var result any
+	var apiErr *apiError
+	if err != nil {
+		apiErr = badRequest("%v", err)
+	} else if apiErr = s.takeFailure(method); apiErr == nil {
+		result, apiErr = s.handle(req)
+	}
+	if apiErr != nil {
+		req.Err = apiErr.description
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	writeResponse(w, apiErr, result)
+}
+
+func (s *Server) takeFailure(method string) *apiError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queued := s.failures[method]
+	if len(queued) == 0 {
+		return nil
+	}
+	f := queued[0]
+	s.failures[method] = queued[1:]
+	return &apiError{code: f.code, description: f.description, retryAfter: f.retryAfter}
+}
+
+func writeResponse(w http.ResponseWriter, apiErr *apiError, result any) {
+	resp := apiResponse{OK: true, Result: result}
+	status := http.StatusOK
+	if apiErr != nil {
+		resp = apiResponse{Description: apiErr.description, ErrorCode: apiErr.code}
+		if apiErr.retryAfter > 0 {
+			resp.Parameters = &responseParameters{RetryAfter: apiErr.retryAfter}
+		}
+		status = apiErr.code
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readParams collects the query string, form or multipart fields of a call, and stores
+// uploaded files in files.
+func readParams(r *http.Request, files map[string]File) (url.Values, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+			return nil, fmt.Errorf("invalid multipart body: %v", err)
+		}
+		for field, headers := range r.MultipartForm.File {
+			file, err := headers[0].Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[field] = File{Name: headers[0].Filename, Data: data}
+		}
+		return r.Form, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return r.Form, nil
+}
+
+func (s *Server) handle(req Request) (any, *apiError) {
+	p := req.Params
+	switch req.Method {
+	case "getMe":
+		return telegram.User{ID: 1, IsBot: true, FirstName: "Fake Bot", Username: "fake_bot"}, nil
+	case "getUpdates":
+		return s.pendingUpdates(p.Get("offset")), nil
+	case "getChat":
+		chat, apiErr := requireChat(p)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		return chat, nil
+	case "sendMessage":
+		chat, apiErr := requireChat(p)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		text := p.Get("text")
+		if text == "" {
+			return nil, badRequest("message text is empty")
+		}
+		if err := CheckMarkup(text, p.Get("parse_mode")); err != nil {
+			return nil, badRequest("can't parse entities: %v", err)
+		}
+		if len([]rune(text)) > 4096 {
+			return nil, badRequest("message is too long")
+		}
+		if apiErr := checkSendOptions(p); apiErr != nil {
+			return nil, apiErr
+		}
+		message := s.newMessage(chat)
+		message.Text = text
+		return message, nil
+	case "sendVideoNote":
+		chat, apiErr := requireChat(p)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		note, apiErr := s.videoNote(req)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		if apiErr := checkSendOptions(p); apiErr != nil {
+			return nil, apiErr
+		}
+		message := s.newMessage(chat)
+		message.VideoNote = note
+		return message, nil
+	case "sendVideo":
+		chat, apiErr := requireChat(p)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		if _, ok := req.Files["video"]; !ok && p.Get("video") == "" {
+			return nil, badRequest("there is no video in the request")
+		}
+		if apiErr := checkSendOptions(p); apiErr != nil {
+			return nil, apiErr
+		}
+		message := s.newMessage(chat)
+		message.Text = p.Get("caption")
+		return message, nil
+	case "editMessageMedia":
+		chat, apiErr := requireChat(p)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		messageID, apiErr := requireMessageID(p)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		var media struct {
+			Type    string `json:"type"`
+			Media   string `json:"media"`
+			Caption string `json:"caption"`
+		}
+		if err := json.Unmarshal([]byte(p.Get("media")), &media); err != nil {
+			return nil, badRequest("can't parse InputMedia JSON object")
+		}
+		if attach, ok := strings.CutPrefix(media.Media, "attach://"); ok {
+			if _, ok := req.Files[attach]; !ok {
+				return nil, badRequest("file %q not found in the request", attach)
+			}
+		}
+		message := s.newMessage(chat)
+		message.MessageID = messageID
+		message.Text = media.Caption
+		return message, nil
+	case "deleteMessage":
+		if _, apiErr := requireChat(p); apiErr != nil {
+			return nil, apiErr
+		}
+		if _, apiErr := requireMessageID(p); apiErr != nil {
+			return nil, apiErr
+		}
+		return true, nil
+	case "answerInlineQuery":
+		if apiErr := checkInlineResults(p.Get("results")); apiErr != nil {
+			return nil, apiErr
+		}
+		return true, nil
+	case "editMessageReplyMarkup", "editMessageText", "answerCallbackQuery",
+		"setWebhook", "deleteWebhook":
+		return true, nil
+	default:
+		return nil, &apiError{code: http.StatusNotFound, description: "Not Found"}
+	}
+}
+
+func (s *Server) pendingUpdates(offset string) []telegram.Update {
+	from, _ := strconv.Atoi(offset)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updates := []telegram.Update{}
+	for _, u := range s.updates {
+		if u.UpdateID >= from {
+			updates = append(updates, u)
+		}
+	}
+	return updates
+}
+
+func (s *Server) newMessage(chat telegram.Chat) *telegram.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextMessageID++
+	return &telegram.Message{
+		MessageID: s.nextMessageID,
+		From:      &telegram.User{ID: 1, IsBot: true, FirstName: "Fake Bot", Username: "fake_bot"},
+		Chat:      chat,
+	}
+}
+
+// videoNote checks the video_note of a sendVideoNote call: an upload or a file_id, at most
+// a minute long and 640 pixels wide, as Telegram requires.
+func (s *Server) videoNote(req Request) (*telegram.VideoNote, *apiError) {
+	p := req.Params
+	length, err := optionalInt(p, "length")
+	if err != nil || length < 0 || length > 640 {
+		return nil, badRequest("wrong video note length")
+	}
+	duration, err := optionalInt(p, "duration")
+	if err != nil || duration < 0 || duration > 60 {
+		return nil, badRequest("wrong video note duration")
+	}
+
+	fileID := p.Get("video_note")
+	if file, ok := req.Files["video_note"]; ok {
+		if len(file.Data) == 0 {
+			return nil, badRequest("file must be non-empty")
+		}
+		s.mu.Lock()
+		s.nextFileID++
+		fileID = fmt.Sprintf("%s%d", videoNoteFileIDPrefix, s.nextFileID)
+		s.mu.Unlock()
+	} else if fileID == "" {
+		return nil, badRequest("there is no video note in the request")
+	}
+	return &telegram.VideoNote{FileID: fileID, FileUniqueID: "u" + fileID, Length: length, Duration: duration}, nil
+}
+
+// checkInlineResults validates the results of answerInlineQuery. Telegram checks the type
+// of cached files, so video notes sent by this server are refused as cached videos.
+func checkInlineResults(results string) *apiError {
+	var parsed []struct {
+		Type        string `json:"type"`
+		ID          string `json:"id"`
+		VideoFileID string `json:"video_file_id"`
+	}
+	if err := json.Unmarshal([]byte(results), &parsed); err != nil {
+		return badRequest("can't parse inline query results JSON object")
+	}
+	for _, r := range parsed {
+		if r.ID == "" || len(r.ID) > 64 {
+			return badRequest("RESULT_ID_INVALID")
+		}
+		if r.Type == "video" && strings.HasPrefix(r.VideoFileID, videoNoteFileIDPrefix) {
+			return badRequest("can't use file of type VideoNote as Video")
+		}
+	}
+	return nil
+}
+
+func requireChat(p url.Values) (telegram.Chat, *apiError) {
+	chatID := p.Get("chat_id")
+	if chatID == "" {
+		return telegram.Chat{}, badRequest("chat_id is empty")
+	}
+	if id, err := strconv.ParseInt(chatID, 10, 64); err == nil {
+		chatType := "private"
+		if id < 0 {
+			chatType = "supergroup"
+		}
+		return telegram.Chat{ID: id, Type: chatType}, nil
+	}
+	username, ok := strings.CutPrefix(chatID, "@")
+	if !ok || username == "" {
+		return telegram.Chat{}, badRequest("chat not found")
+	}
+	// Public usernames get a stable made-up channel ID.
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(username)))
+	return telegram.Chat{ID: -1000000000000 - int64(h.Sum32()), Type: "channel", Username: username}, nil
+}
+
+func requireMessageID(p url.Values) (int, *apiError) {
+	id, err := strconv.Atoi(p.Get("message_id"))
+	if err != nil || id <= 0 {
+		return 0, badRequest("message identifier is not specified")
+	}
+	return id, nil
+}
+
+func optionalInt(p url.Values, key string) (int, error) {
+	if !p.Has(key) {
+		return 0, nil
+	}
+	return strconv.Atoi(p.Get(key))
+}
+
+// checkSendOptions validates the optional fields the client sets from SendOptions.
+func checkSendOptions(p url.Values) *apiError {
+	if p.Has("message_thread_id") {
+		if id, err := strconv.Atoi(p.Get("message_thread_id")); err != nil || id <= 0 {
+			return badRequest("message thread not found")
+		}
+	}
+	if p.Has("disable_notification") {
+		if _, err := strconv.ParseBool(p.Get("disable_notification")); err != nil {
+			return badRequest("invalid disable_notification")
+		}
+	}
+	if p.Has("reply_parameters") {
+		var reply struct {
+			MessageID int `json:"message_id"`
+		}
+		if err := json.Unmarshal([]byte(p.Get("reply_parameters")), &reply); err != nil || reply.MessageID <= 0 {
+			return badRequest("can't parse reply parameters JSON object")
+		}
+	}
+	if p.Has("reply_markup") {
+		var markup map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(p.Get("reply_markup")), &markup); err != nil {
+			return badRequest("can't parse reply keyboard markup JSON object")
+		}
+		if raw, ok := markup["inline_keyboard"]; ok {
+			var keyboard telegram.InlineKeyboardMarkup
+			if err := json.Unmarshal([]byte(`{"inline_keyboard":`+string(raw)+`}`), &keyboard); err != nil {
+				return badRequest("can't parse inline keyboard button: %v", err)
+			}
+			for _, row := range keyboard.InlineKeyboard {
+				for _, button := range row {
+					if button.Text == "" {
+						return badRequest("inline keyboard button text is empty")
+					}
+					if len(button.CallbackData) > 64 {
+						return badRequest("BUTTON_DATA_INVALID")
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package telegram
+
+import "encoding/json"
+
+type VideoNote struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Length       int    `json:"length"`
+	Duration     int    `json:"duration"`
+}
+
+type User struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username,omitempty"`
+}
+
+type Chat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type Message struct {
+	MessageID int        `json:"message_id"`
+	From      *User      `json:"from,omitempty"`
+	Chat      Chat       `json:"chat"`
+	Text      string     `json:"text,omitempty"`
+	VideoNote *VideoNote `json:"video_note,omitempty"`
+	// ReplyToMessage is the message this one replies to, if any.
+	ReplyToMessage *Message `json:"reply_to_message,omitempty"`
+}
+
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data,omitempty"`
+}
+
+type Update struct {
+	UpdateID      int                `json:"update_id"`
+	Message       *Message           `json:"message,omitempty"`
+	ChannelPost   *Message           `json:"channel_post,omitempty"`
+	MyChatMember  *ChatMemberUpdated `json:"my_chat_member,omitempty"`
+	CallbackQuery *CallbackQuery     `json:"callback_query,omitempty"`
+	InlineQuery   *InlineQuery       `json:"inline_query,omitempty"`
+}
+
+// ChatMemberUpdated reports that the bot was added to or removed from a chat, or its rights changed.
+type ChatMemberUpdated struct {
+	Chat Chat `json:"chat"`
+	From User `json:"from"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type ForceReply struct {
+	ForceReply            bool   `json:"force_reply"`
+	InputFieldPlaceholder string `json:"input_field_placeholder,omitempty"`
+}
+
+type InlineQuery struct {
+	ID     string `json:"id"`
+	From   User   `json:"from"`
+	Query  string `json:"query"`
+	Offset string `json:"offset"`
+}
+
+// InlineQueryResultCachedVideo is an inline result pointing at a file already stored on Telegram.
+type InlineQueryResultCachedVideo struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	VideoFileID string `json:"video_file_id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// InlineQueryResultsButton is shown above the inline results and opens a private chat
+// with the bot, sending /start with StartParameter.
+type InlineQueryResultsButton struct {
+	Text           string `json:"text"`
+	StartParameter string `json:"start_parameter"`
+}
+
+type response struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+	ErrorCode   int             `json:"error_code"`
+}
@@ -0,0 +1,165 @@
+package transcode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter is one ffmpeg filter with its options, e.g. Filter{"trim", []string{"start=5", "duration=30"}}.
+type Filter struct {
+	Name    string
+	Options []string
+}
+
+func (f Filter) String() string {
+	if len(f.Options) == 0 {
+		return f.Name
+	}
+	return f.Name + "=" + strings.Join(f.Options, ":")
+}
+
+// FilterChain applies Filters in order to the Inputs pads and labels the result Outputs.
+type FilterChain struct {
+	Inputs  []string
+	Filters []Filter
+	Outputs []string
+}
+
+func (c FilterChain) String() string {
+	var sb strings.Builder
+	for _, pad := range c.Inputs {
+		sb.WriteString("[" + pad + "]")
+	}
+	filters := make([]string, len(c.Filters))
+	for i, f := range c.Filters {
+		filters[i] = f.String()
+	}
+	sb.WriteString(strings.Join(filters, ","))
+	for _, pad := range c.Outputs {
+		sb.WriteString("[" + pad + "]")
+	}
+	return sb.String()
+}
+
+// FilterGraph is the value of -filter_complex.
+type FilterGraph []FilterChain
+
+func (g FilterGraph) String() string {
+	chains := make([]string, len(g))
+	for i, c := range g {
+		chains[i] = c.String()
+	}
+	return strings.Join(chains, ";")
+}
+
+// Command is an ffmpeg invocation, kept structured so callers can inspect it before it runs.
+type Command struct {
+	// InputOptions go before -i, e.g. -fflags +genpts.
+	InputOptions []string
+	Input        string
+	// Filters is the -filter_complex graph; empty means none.
+	Filters FilterGraph
+	// Maps are the -map targets, e.g. "[vout]".
+	Maps []string
+	// OutputOptions are the codec and muxer options.
+	OutputOptions []string
+	Output        string
+}
+
+// Args returns the command line arguments for ffmpeg, without the program name.
+func (c Command) Args() []string {
+	args := append([]string{}, c.InputOptions...)
+	args = append(args, "-i", c.Input)
+	if len(c.Filters) > 0 {
+		args = append(args, "-filter_complex", c.Filters.String())
+	}
+	for _, m := range c.Maps {
+		args = append(args, "-map", m)
+	}
+	args = append(args, c.OutputOptions...)
+	return append(args, "-y", c.Output)
+}
+
+// DefaultFade is how long the audio fades in and out at the ends of a clip, in seconds.
+const DefaultFade = 1.0
+
+// CutOptions describe the clip Cut makes.
+type CutOptions struct {
+	Start    int `json:"start"`
+	Duration int `json:"duration"`
+	// Size is the width and height of the square output in pixels.
+	Size int `json:"size"`
+	// FadeIn and FadeOut are the audio fade lengths in seconds; zero means no fade.
+	FadeIn  float64 `json:"fade_in"`
+	FadeOut float64 `json:"fade_out"`
+}
+
+// CutCommand builds the ffmpeg command that cuts opts.Duration seconds of input starting at
+// opts.Start, crops the centre square, scales it to opts.Size and fades the audio.
+func CutCommand(input, output string, opts CutOptions) Command {
+	trim := []string{"start=" + strconv.Itoa(opts.Start), "duration=" + strconv.Itoa(opts.Duration)}
+	size := strconv.Itoa(opts.Size)
+
+	video := FilterChain{
+		Inputs: []string{"0:v"},
+		Filters: []Filter{
+			{"trim", trim},
+			{"setpts", []string{"PTS-STARTPTS"}},
+			{"crop", []string{"ih", "ih"}},
+			{"scale", []string{size, size}},
+		},
+		Outputs: []string{"vout"},
+	}
+	audio := FilterChain{
+		Inputs: []string{"0:a"},
+		Filters: []Filter{
+			{"atrim", trim},
+			{"asetpts", []string{"PTS-STARTPTS"}},
+		},
+		Outputs: []string{"aout"},
+	}
+	if opts.FadeIn > 0 {
+		audio.Filters = append(audio.Filters, Filter{"afade", []string{"t=in", "st=0", "d=" + seconds(opts.FadeIn)}})
+	}
+	if opts.FadeOut > 0 {
+		fadeOutStart := max(float64(opts.Duration)-opts.FadeOut, 0)
+		audio.Filters = append(audio.Filters, Filter{"afade", []string{"t=out", "st=" + seconds(fadeOutStart), "d=" + seconds(opts.FadeOut)}})
+	}
+
+	return Command{
+		Input:   input,
+		Filters: FilterGraph{video, audio},
+		Maps:    []string{"[vout]", "[aout]"},
+		OutputOptions: []string{
+			"-c:v", "libx264",
+			"-profile:v", "baseline",
+			"-pix_fmt", "yuv420p",
+			"-preset", "medium",
+			"-c:a", "aac",
+			"-b:a", "128k",
+			"-movflags", "+faststart",
+		},
+		Output: output,
+	}
+}
+
+// NormalizeCommand builds the ffmpeg command that re-encodes input at 30 fps with
+// regenerated timestamps.
+func NormalizeCommand(input, output string) Command {
+	return Command{
+		InputOptions: []string{"-fflags", "+genpts"},
+		Input:        input,
+		OutputOptions: []string{
+			"-vf", "fps=30,setpts=PTS-STARTPTS",
+			"-af", "asetpts=PTS-STARTPTS",
+			"-ar", "44100",
+			"-preset", "ultrafast",
+		},
+		Output: output,
+	}
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.2f", s)
+}
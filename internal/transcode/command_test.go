@@ -0,0 +1,207 @@
+package transcode
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current commands")
+
+// goldenDir holds the arguments of each case's command, one per line.
+const goldenDir = "testdata/golden"
+
+// Golden file paths are fixed so the files don't depend on the machine they were made on.
+const (
+	goldenInput  = "input.mp4"
+	goldenOutput = "output"
+)
+
+// commandCase is one combination of options. With neither cut, mask nor sheet set it is the
+// normalize command.
+type commandCase struct {
+	name  string
+	cut   *CutOptions
+	mask  bool
+	sheet *SheetOptions
+}
+
+func (c commandCase) command(input, output string) Command {
+	switch {
+	case c.cut != nil:
+		return CutCommand(input, output, *c.cut)
+	case c.mask:
+		return MaskCommand(input, output)
+	case c.sheet != nil:
+		return SheetCommand(input, output, *c.sheet)
+	}
+	return NormalizeCommand(input, output)
+}
+
+// ext is the file extension of the case's output.
+func (c commandCase) ext() string {
+	switch {
+	case c.mask:
+		return ".webm"
+	case c.sheet != nil:
+		return ".png"
+	}
+	return ".mp4"
+}
+
+// commandCases cover every option of the builders, including fades longer than the clip.
+var commandCases = []commandCase{
+	{name: "cut-default", cut: &CutOptions{Start: 0, Duration: 30, Size: VideoNoteSize, FadeIn: DefaultFade, FadeOut: DefaultFade}},
+	{name: "cut-offset", cut: &CutOptions{Start: 95, Duration: 60, Size: VideoNoteSize, FadeIn: DefaultFade, FadeOut: DefaultFade}},
+	{name: "cut-no-fades", cut: &CutOptions{Start: 12, Duration: 20, Size: VideoNoteSize}},
+	{name: "cut-fade-in-only", cut: &CutOptions{Start: 12, Duration: 20, Size: VideoNoteSize, FadeIn: 2.5}},
+	{name: "cut-fade-out-only", cut: &CutOptions{Start: 12, Duration: 20, Size: VideoNoteSize, FadeOut: 0.5}},
+	{name: "cut-fade-longer-than-clip", cut: &CutOptions{Start: 3, Duration: 10, Size: VideoNoteSize, FadeIn: 12, FadeOut: 12}},
+	{name: "cut-size-640", cut: &CutOptions{Start: 0, Duration: 45, Size: 640, FadeIn: DefaultFade, FadeOut: DefaultFade}},
+	{name: "normalize"},
+	{name: "preview-mask", mask: true},
+	{name: "preview-sheet", sheet: &SheetOptions{Columns: 4, Rows: 3, Duration: 30, Size: 200}},
+	{name: "preview-sheet-short", sheet: &SheetOptions{Columns: 2, Rows: 1, Duration: 0, Size: 100}},
+}
+
+// TestCommandGolden compares the arguments of every command with its golden file. After an
+// intended change, rewrite the files with go test ./internal/transcode -update and review
+// the diff.
+func TestCommandGolden(t *testing.T) {
+	for _, c := range commandCases {
+		t.Run(c.name, func(t *testing.T) {
+			got := strings.Join(c.command(goldenInput, goldenOutput+c.ext()).Args(), "\n") + "\n"
+			path := filepath.Join(goldenDir, c.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("%s is missing; run with -update to create it", path)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := diffLines(string(want), got); diff != "" {
+				t.Errorf("arguments differ from %s: %s\nRun with -update if the change is intended.", path, diff)
+			}
+		})
+	}
+}
+
+// diffLines describes the first line where got differs from want.
+func diffLines(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d: want %q, got %q", i+1, w, g)
+		}
+	}
+	return "files differ"
+}
+
+// ffmpegSource is how long the generated input of TestCommandFFmpeg is, in seconds.
+const ffmpegSource = 6
+
+// TestCommandFFmpeg runs every case, shortened to fit, through ffmpeg on a generated test
+// pattern and tone. When ffprobe is installed it also checks that cut clips have the
+// requested size and an audio stream.
+func TestCommandFFmpeg(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "source.mp4")
+	generate := exec.Command("ffmpeg",
+		"-f", "lavfi", "-i", fmt.Sprintf("testsrc=size=640x360:rate=30:duration=%d", ffmpegSource),
+		"-f", "lavfi", "-i", fmt.Sprintf("sine=frequency=440:duration=%d", ffmpegSource),
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest", "-y", input)
+	if out, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate test input: %v\n%s", err, out)
+	}
+
+	for _, c := range commandCases {
+		t.Run(c.name, func(t *testing.T) {
+			run := c
+			if c.cut != nil {
+				opts := *c.cut
+				opts.Start = min(opts.Start, 1)
+				opts.Duration = min(opts.Duration, ffmpegSource-opts.Start-1)
+				run.cut = &opts
+			}
+			if c.sheet != nil {
+				opts := *c.sheet
+				opts.Duration = min(opts.Duration, ffmpegSource)
+				run.sheet = &opts
+			}
+			output := filepath.Join(dir, c.name+c.ext())
+			if out, err := exec.Command("ffmpeg", run.command(input, output).Args()...).CombinedOutput(); err != nil {
+				t.Fatalf("ffmpeg failed: %v\n%s", err, lastLines(string(out), 5))
+			}
+			info, err := os.Stat(output)
+			if err != nil || info.Size() == 0 {
+				t.Fatalf("no output: %v", err)
+			}
+			if run.cut != nil {
+				probeClip(t, output, run.cut.Size)
+			}
+		})
+	}
+}
+
+// probeClip checks the size and audio of a cut clip, if ffprobe is installed.
+func probeClip(t *testing.T, path string, size int) {
+	t.Helper()
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return
+	}
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "stream=codec_type,width,height", "-of", "csv=p=0", path).Output()
+	if err != nil {
+		t.Fatalf("ffprobe failed: %v", err)
+	}
+	var hasVideo, hasAudio bool
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, ",")
+		switch fields[0] {
+		case "video":
+			hasVideo = true
+			want := strconv.Itoa(size)
+			if len(fields) < 3 || fields[1] != want || fields[2] != want {
+				t.Errorf("video is %s, want %dx%d", strings.Join(fields[1:], "x"), size, size)
+			}
+		case "audio":
+			hasAudio = true
+		}
+	}
+	if !hasVideo || !hasAudio {
+		t.Errorf("output is missing a stream (video: %t, audio: %t)", hasVideo, hasAudio)
+	}
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
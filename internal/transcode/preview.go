@@ -0,0 +1,90 @@
+package transcode
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// circleMask is a geq filter that keeps the luma and chroma and makes everything outside
+// the inscribed circle transparent, the way Telegram crops a video note. The edge is
+// blended over one pixel so it isn't jagged.
+var circleMask = Filter{"geq", []string{
+	"lum='p(X,Y)'",
+	"a='255*clip(min(W,H)/2-hypot(X-W/2+0.5,Y-H/2+0.5)+0.5,0,1)'",
+}}
+
+// MaskCommand builds the ffmpeg command that renders input with the video note's round
+// mask as VP9 WebM, which keeps the transparency.
+func MaskCommand(input, output string) Command {
+	return Command{
+		Input: input,
+		Filters: FilterGraph{{
+			Inputs:  []string{"0:v"},
+			Filters: []Filter{{"format", []string{"yuva420p"}}, circleMask},
+			Outputs: []string{"vout"},
+		}},
+		Maps: []string{"[vout]", "0:a?"},
+		OutputOptions: []string{
+			"-c:v", "libvpx-vp9",
+			"-pix_fmt", "yuva420p",
+			"-crf", "32",
+			"-b:v", "0",
+			"-c:a", "libopus",
+			"-b:a", "96k",
+		},
+		Output: output,
+	}
+}
+
+// SheetOptions describe a contact sheet.
+type SheetOptions struct {
+	Columns int
+	Rows    int
+	// Duration is the length of the input in seconds; the frames are spread evenly over it.
+	Duration int
+	// Size is the width and height of each frame in pixels.
+	Size int
+}
+
+// DefaultSheet is a 4x3 sheet of 200 pixel frames.
+var DefaultSheet = SheetOptions{Columns: 4, Rows: 3, Size: 200}
+
+// SheetCommand builds the ffmpeg command that writes a PNG of Columns x Rows masked frames
+// taken at even intervals across the input.
+func SheetCommand(input, output string, opts SheetOptions) Command {
+	frames := opts.Columns * opts.Rows
+	size := strconv.Itoa(opts.Size)
+	return Command{
+		Input: input,
+		Filters: FilterGraph{{
+			Inputs: []string{"0:v"},
+			Filters: []Filter{
+				{"fps", []string{fmt.Sprintf("%d/%d", frames, max(opts.Duration, 1))}},
+				{"scale", []string{size, size}},
+				{"format", []string{"yuva420p"}},
+				circleMask,
+				{"tile", []string{fmt.Sprintf("%dx%d", opts.Columns, opts.Rows), "padding=8", "margin=8", "color=black@0"}},
+				{"format", []string{"rgba"}},
+			},
+			Outputs: []string{"vout"},
+		}},
+		Maps:          []string{"[vout]"},
+		OutputOptions: []string{"-frames:v", "1"},
+		Output:        output,
+	}
+}
+
+// Duration asks ffprobe how long a video is, in whole seconds rounded up.
+func Duration(path string) (int, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "csv=p=0", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to probe %s: %w", path, err)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to probe %s: unexpected duration %q", path, strings.TrimSpace(string(out)))
+	}
+	return int(seconds + 0.999), nil
+}
@@ -0,0 +1,87 @@
+// Package transcode cuts video notes out of source videos with ffmpeg.
+package transcode
+
+import (
+	"bufio"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+)
+
+// VideoNoteSize is the width and height of the video notes Cut makes.
+const VideoNoteSize = 400
+
+// FFmpeg encodes video notes by running ffmpeg.
+type FFmpeg struct{}
+
+// Normalize re-encodes inputFile with regenerated timestamps to fix broken sources.
+func (f *FFmpeg) Normalize(inputFile, normalizedFile string) error {
+	slog.Debug("Normalizing video to fix broken timestamps", "input", inputFile, "output", normalizedFile)
+	return Run(NormalizeCommand(inputFile, normalizedFile))
+}
+
+// Cut encodes durationSeconds of inputFile starting at startTimeSec into a square video
+// note with faded audio. If progress is not nil, it is called as the encode moves along.
+func (f *FFmpeg) Cut(inputFile, outputFile string, startTimeSec int, durationSeconds int, progress func(fraction float64)) error {
+	slog.Debug("Encoding video note", "input", inputFile, "output", outputFile, "start", startTimeSec, "duration", durationSeconds)
+	c := CutCommand(inputFile, outputFile, VideoNoteOptions(startTimeSec, durationSeconds))
+	if progress == nil {
+		return Run(c)
+	}
+	return RunProgress(c, time.Duration(durationSeconds)*time.Second, progress)
+}
+
+// VideoNoteOptions are the options Cut encodes video notes with.
+func VideoNoteOptions(start, duration int) CutOptions {
+	return CutOptions{
+		Start:    start,
+		Duration: duration,
+		Size:     VideoNoteSize,
+		FadeIn:   DefaultFade,
+		FadeOut:  DefaultFade,
+	}
+}
+
+// Run runs ffmpeg with the command's arguments, passing its output to logging.Output.
+func Run(c Command) error {
+	cmd := exec.Command("ffmpeg", c.Args()...)
+	cmd.Stdout = logging.Output
+	cmd.Stderr = logging.Output
+	return cmd.Run()
+}
+
+// RunProgress runs ffmpeg like Run, but has it report its progress instead of printing its
+// statistics, and calls progress with the share of length, the output's duration, encoded
+// so far.
+func RunProgress(c Command, length time.Duration, progress func(fraction float64)) error {
+	cmd := exec.Command("ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, c.Args()...)...)
+	cmd.Stderr = logging.Output
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// -progress writes blocks of key=value lines; out_time_us is how much has been encoded.
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && length > 0 {
+				progress(min(max(float64(us)/float64(length.Microseconds()), 0), 1))
+			}
+		case "progress":
+			if value == "end" {
+				progress(1)
+			}
+		}
+	}
+	return cmd.Wait()
+}
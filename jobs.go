@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+const defaultWorkDir = "temp"
+
+// printJobStatus is an OnStatus callback for the command line.
+func printJobStatus(job *pipeline.ClipJob) {
+	events.jobStatus(job)
+	status, err := job.Status()
+	switch status {
+	case pipeline.ClipDone:
+		fmt.Printf("✅ [%s] %s: done in %s\n", job.ID, job.Label, job.Elapsed().Round(time.Second))
+	case pipeline.ClipFailed:
+		fmt.Printf("❌ [%s] %s: %s\n", job.ID, job.Label, logging.Redact(err.Error()))
+	default:
+		fmt.Printf("⏳ [%s] %s: %s\n", job.ID, job.Label, status)
+	}
+}
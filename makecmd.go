@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+var makeCmd = &command{
+	name:    "make",
+	args:    "[flags]",
+	summary: "make a circle from a song link and publish it",
+	about: "Downloads a song, cuts a fragment and sends it as a Telegram video note. With -o the clip\n" +
+		"is written to a directory with a JSON manifest instead, to be posted later with publish.\n\n" +
+		"For age-restricted videos a cookies file is needed; youtube_cookies.txt in the\n" +
+		"working directory is used if it exists.",
+	config: true,
+	events: true,
+	setup:  setupMake,
+}
+
+func setupMake(fs *flag.FlagSet, common *commonFlags) func(string) {
+	urlFlag := fs.String("url", "", "URL to a song (e.g., from song.link) (required)")
+	startFlag := fs.Int("start", -1, "Start time in seconds (required)")
+	durationFlag := fs.Int("duration", -1, "Duration in seconds (required, max 59)")
+	songnameFlag := fs.String("songname", "", "Custom song name (optional, requires authorname)")
+	authornameFlag := fs.String("authorname", "", "Custom author name (optional, requires songname)")
+	cookiesFlag := fs.String("cookies", "youtube_cookies.txt", "Path to a cookies file")
+	testFlag := fs.Bool("t", false, "Use the test Telegram channel")
+	var toFlag stringListFlag
+	fs.Var(&toFlag, "to", "Comma-separated destination names from config.json, or \"all\" (can be repeated; overrides -t)")
+	removeFlag := fs.Bool("r", true, "Remove temporary files after completion (e.g., -r=false to keep)")
+	historyFlag := fs.String("history", defaultHistoryPath, "Path to the local history of posted video notes")
+	forceFlag := fs.Bool("force", false, "Post even if the track was already posted to a destination within duplicate_window")
+	var scheduleFlag string
+	fs.StringVar(&scheduleFlag, "at", "", "Queue the clip and publish it later via the daemon command (RFC 3339, \"2006-01-02 15:04\", \"15:04\" or \"+2h\")")
+	fs.StringVar(&scheduleFlag, "schedule", "", "Alias for -at")
+	queueFlag := fs.String("queue", defaultQueueDir, "Directory holding scheduled jobs")
+	messageTemplateFlag := fs.String("message-template", "", "text/template for the link message, overriding config.json for this run (prefix with @ to read from a file)")
+	parseModeFlag := fs.String("parse-mode", "", "Telegram parse_mode for the link message: MarkdownV2 or HTML (default from config.json, else MarkdownV2)")
+	outputFlag := fs.String("o", "", "Write the clip and its manifest to this directory instead of publishing; post them later with publish")
+
+	return func(string) {
+		if *urlFlag == "" || *startFlag == -1 || *durationFlag == -1 {
+			slog.Error("Missing required flags: -url, -start, -duration")
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		if *outputFlag != "" && scheduleFlag != "" {
+			fatal(exitUsage, "-o and -at can't be combined; schedule when publishing instead")
+		}
+
+		cfg, _, err := common.loadConfig()
+		if err != nil {
+			fatal(exitFailure, "Failed to load config", "err", err)
+		}
+
+		destinations, err := cfg.ResolveDestinations(toFlag, *testFlag)
+		if err != nil {
+			fatal(exitUsage, "Invalid destinations", "err", err)
+		}
+		if len(toFlag) == 0 && *testFlag {
+			fmt.Println("🚀 Using TEST channel.")
+		}
+		runTemplate, err := loadTemplateArg(*messageTemplateFlag)
+		if err != nil {
+			fatal(exitFailure, "Failed to load message template", "err", err)
+		}
+		destinations, err = pipeline.ApplyMessageTemplates(destinations, cfg, runTemplate, *parseModeFlag)
+		if err != nil {
+			fatal(exitUsage, "Invalid message template", "err", err)
+		}
+
+		var publishAt time.Time
+		if scheduleFlag != "" {
+			publishAt, err = parseScheduleTime(scheduleFlag, time.Now())
+			if err != nil {
+				fatal(exitUsage, "Invalid schedule time", "err", err)
+			}
+			if !publishAt.After(time.Now()) {
+				fatal(exitUsage, "Schedule time is in the past", "at", publishAt.Format(time.RFC3339))
+			}
+		}
+
+		desiredDurationSec, clamped, err := pipeline.ClampDuration(*durationFlag)
+		if err != nil {
+			fatal(exitUsage, "Invalid duration", "err", err)
+		}
+		if clamped {
+			slog.Warn("Requested duration is above the limit, clamping it", "duration", *durationFlag, "max", pipeline.MaxClipDuration)
+		}
+
+		pl := pipeline.New(cfg, *cookiesFlag)
+		pool := pipeline.NewWorkerPool(pl, defaultWorkDir, cfg.Workers)
+		watchJobs(pool)
+		job, err := pool.Submit(*urlFlag, pipeline.ClipRequest{
+			URL:        *urlFlag,
+			Start:      *startFlag,
+			Duration:   desiredDurationSec,
+			SongName:   *songnameFlag,
+			AuthorName: *authornameFlag,
+		})
+		if err != nil {
+			fatal(exitFailure, "Failed to start job", "err", err)
+		}
+		tempDir := job.WorkDir
+		clip, err := job.Wait()
+		if err != nil {
+			if *removeFlag {
+				os.RemoveAll(tempDir)
+			}
+			fatal(stageExitCode(err), "Making the clip failed", "job", job.ID, "stage", pipeline.ErrorStage(err), "err", err)
+		}
+
+		fmt.Printf("\n✅ Done! File: %s\n", clip.Path)
+
+		failed := 0
+		var manifestPath string
+		var manifestErr error
+		if *outputFlag != "" {
+			manifestPath, manifestErr = writeManifest(cfg, *outputFlag, clip, pl.MessageData(clip, cfg, destinations), destinations)
+		} else {
+			failed, _ = deliverClip(cfg, pl, clip, nil, destinations, publishAt, *historyFlag, *queueFlag, *forceFlag)
+		}
+
+		if *removeFlag {
+			fmt.Println("Cleaning up temporary files...")
+			err = os.RemoveAll(tempDir)
+			if err != nil {
+				slog.Warn("Failed to remove temporary directory", "path", tempDir, "err", err)
+			} else {
+				fmt.Println("✅ Cleanup complete.")
+			}
+		} else {
+			fmt.Printf("✅ Skipping temporary files cleanup. Files are in '%s' directory.\n", tempDir)
+		}
+
+		if manifestErr != nil {
+			fatal(exitFailure, "Failed to write manifest", "err", manifestErr)
+		}
+		if manifestPath != "" {
+			events.emit(event{Type: "manifest", URL: clip.Request.URL, Path: manifestPath})
+			fmt.Printf("📝 Wrote %s. Check the clip, then post it with:\n  %s\n", manifestPath, shellJoin([]string{programName(), "publish", manifestPath}))
+		}
+		if failed > 0 {
+			fatal(exitPublish, "Publishing failed", "failed", failed, "destinations", len(destinations))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+	"github.com/Ma11doror/tgCircleGen/internal/resolve"
+	"github.com/Ma11doror/tgCircleGen/internal/transcode"
+)
+
+const manifestVersion = 1
+
+// Manifest describes a clip written by make -o: where it came from, how it was encoded and
+// what to post with it, so publish can post it later, possibly on another machine. The
+// clip is kept next to the manifest, and so is the video it was cut from when a
+// destination is moderated.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Clip is the video note's file name, relative to the manifest.
+	Clip       string `json:"clip"`
+	ClipSHA256 string `json:"clip_sha256"`
+	// SourceVideo is the downloaded video's file name, relative to the manifest. Moderators
+	// re-cut the clip from it, so without it the clip can't go to moderated destinations.
+	// It is only kept when one of the destinations is moderated.
+	SourceVideo string               `json:"source_video,omitempty"`
+	Source      ManifestSource       `json:"source"`
+	Encoding    transcode.CutOptions `json:"encoding"`
+	// Data is what the link message templates are rendered with.
+	Data         pipeline.MessageData  `json:"data"`
+	Destinations []ManifestDestination `json:"destinations"`
+}
+
+// ManifestSource is the song the clip was cut from.
+type ManifestSource struct {
+	URL        string `json:"url"`
+	YoutubeURL string `json:"youtube_url,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Artist     string `json:"artist,omitempty"`
+	Display    string `json:"display"`
+}
+
+// ManifestDestination is a destination as resolved when the clip was made.
+type ManifestDestination struct {
+	config.Destination
+	// Text is the link message rendered from Data, to check before publishing. Changing
+	// it has no effect; edit data or message_template instead.
+	Text string `json:"text"`
+}
+
+// newManifest describes clip as made for destinations, with data for the link message.
+func newManifest(clip *pipeline.Clip, data pipeline.MessageData, destinations []config.Destination) (*Manifest, error) {
+	m := &Manifest{
+		Version:   manifestVersion,
+		CreatedAt: time.Now(),
+		Source: ManifestSource{
+			URL:        clip.Request.URL,
+			YoutubeURL: clip.Track.YoutubeURL,
+			Title:      clip.Track.Title,
+			Artist:     clip.Track.Artist,
+			Display:    clip.Display,
+		},
+		Encoding: transcode.VideoNoteOptions(clip.Request.Start, clip.Request.Duration),
+		Data:     data,
+	}
+	for _, d := range destinations {
+		text, err := pipeline.RenderMessage(d.MessageTemplate, d.ParseMode, data)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+		m.Destinations = append(m.Destinations, ManifestDestination{Destination: d, Text: text})
+	}
+	return m, nil
+}
+
+// writeManifest copies the clip into dir, along with its source video if a destination is
+// moderated, and writes the manifest next to them, all named after the track. It returns
+// the manifest's path.
+func writeManifest(cfg *config.Config, dir string, clip *pipeline.Clip, data pipeline.MessageData, destinations []config.Destination) (string, error) {
+	m, err := newManifest(clip, data, destinations)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create output directory %s: %w", dir, err)
+	}
+	m.Clip = clip.FilenameBase + ".mp4"
+	if err := copyFile(clip.Path, filepath.Join(dir, m.Clip)); err != nil {
+		return "", fmt.Errorf("failed to copy clip: %w", err)
+	}
+	sum, err := fileSHA256(filepath.Join(dir, m.Clip))
+	if err != nil {
+		return "", err
+	}
+	m.ClipSHA256 = sum
+	if _, moderated := splitModerated(cfg, destinations); len(moderated) > 0 && clip.SourcePath != "" {
+		m.SourceVideo = clip.FilenameBase + ".source" + filepath.Ext(clip.SourcePath)
+		if err := linkOrCopyFile(clip.SourcePath, filepath.Join(dir, m.SourceVideo)); err != nil {
+			return "", fmt.Errorf("failed to copy source video: %w", err)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	path := filepath.Join(dir, clip.FilenameBase+".json")
+	if err := os.WriteFile(path, append(encoded, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return path, nil
+}
+
+// loadManifest reads a manifest and checks that its clip is there and unchanged.
+func loadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %w", path, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("manifest %s has version %d, this build reads version %d", path, m.Version, manifestVersion)
+	}
+	if m.Clip == "" || m.Source.URL == "" {
+		return nil, fmt.Errorf("manifest %s does not name a clip and its source", path)
+	}
+	sum, err := fileSHA256(m.clipPath(path))
+	if err != nil {
+		return nil, err
+	}
+	if m.ClipSHA256 != "" && sum != m.ClipSHA256 {
+		return nil, fmt.Errorf("%s does not match the checksum in the manifest", m.clipPath(path))
+	}
+	return &m, nil
+}
+
+func (m *Manifest) clipPath(manifestPath string) string {
+	return filepath.Join(filepath.Dir(manifestPath), m.Clip)
+}
+
+// pipelineClip rebuilds the clip the manifest was made from, for deliverClip. Its
+// SourcePath is empty when the source video is not next to the manifest.
+func (m *Manifest) pipelineClip(manifestPath string) *pipeline.Clip {
+	clip := &pipeline.Clip{
+		Request: pipeline.ClipRequest{
+			URL:      m.Source.URL,
+			Start:    m.Encoding.Start,
+			Duration: m.Encoding.Duration,
+		},
+		Track: resolve.TrackInfo{
+			Title:      m.Source.Title,
+			Artist:     m.Source.Artist,
+			YoutubeURL: m.Source.YoutubeURL,
+		},
+		Display:      m.Source.Display,
+		FilenameBase: strings.TrimSuffix(m.Clip, filepath.Ext(m.Clip)),
+		Path:         m.clipPath(manifestPath),
+	}
+	if m.SourceVideo != "" {
+		sourcePath := filepath.Join(filepath.Dir(manifestPath), m.SourceVideo)
+		if _, err := os.Stat(sourcePath); err == nil {
+			clip.SourcePath = sourcePath
+		}
+	}
+	return clip
+}
+
+// linkOrCopyFile hard-links src to dst, so a large video doesn't take up space twice, or
+// copies it where that isn't possible, e.g. across file systems or over an existing dst.
+func linkOrCopyFile(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+	"github.com/Ma11doror/tgCircleGen/internal/resolve"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram/telegramtest"
+)
+
+func TestManifestKeepsSourceForReview(t *testing.T) {
+	srv := telegramtest.NewServer("123:abc")
+	defer srv.Close()
+	cfg := &config.Config{BotToken: srv.Token, APIURL: srv.URL, Moderation: config.ModerationConfig{ChatID: "-300"}}
+
+	workDir := t.TempDir()
+	clip := &pipeline.Clip{
+		Request:      pipeline.ClipRequest{URL: "https://song.link/s/1", Start: 60, Duration: 30},
+		Track:        resolve.TrackInfo{Title: "Song", Artist: "Band"},
+		Display:      `"Song" by Band`,
+		FilenameBase: "Song_by_Band",
+		SourcePath:   filepath.Join(workDir, "Song_by_Band.mp4"),
+		Path:         filepath.Join(workDir, "Song_by_Band_cut.mp4"),
+	}
+	for path, data := range map[string]string{clip.SourcePath: "source", clip.Path: "clip"} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	destinations, err := pipeline.ApplyMessageTemplates([]config.Destination{{Name: "main", ChatID: "@channel", Moderated: true}}, cfg, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pl := pipeline.New(cfg, "")
+	manifestPath, err := writeManifest(cfg, filepath.Join(t.TempDir(), "out"), clip, pl.MessageData(clip, cfg, destinations), destinations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := m.pipelineClip(manifestPath)
+	if published.SourcePath == "" {
+		t.Fatal("the manifest's clip has no source video")
+	}
+
+	queueDir := t.TempDir()
+	if failed, summary := deliverClip(cfg, pl, published, &m.Data, destinations, time.Time{}, filepath.Join(t.TempDir(), "history.jsonl"), queueDir, false); failed > 0 {
+		t.Fatalf("deliverClip failed: %s", summary)
+	}
+	jobs, err := loadJobs(queueDir)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("got %d review jobs (%v), want 1", len(jobs), err)
+	}
+	if data, err := os.ReadFile(jobs[0].SourcePath()); err != nil || string(data) != "source" {
+		t.Errorf("review job has no source video to re-cut from: %v", err)
+	}
+
+	if err := os.Remove(published.SourcePath); err != nil {
+		t.Fatal(err)
+	}
+	if sourcePath := m.pipelineClip(manifestPath).SourcePath; sourcePath != "" {
+		t.Errorf("SourcePath = %q after the source video was removed, want empty", sourcePath)
+	}
+}
+
+func TestManifestSkipsSourceWithoutModeration(t *testing.T) {
+	cfg := &config.Config{Moderation: config.ModerationConfig{ChatID: "-300"}}
+	workDir := t.TempDir()
+	clip := &pipeline.Clip{
+		Request:      pipeline.ClipRequest{URL: "https://song.link/s/1", Start: 60, Duration: 30},
+		Display:      "Song",
+		FilenameBase: "Song",
+		SourcePath:   filepath.Join(workDir, "Song.mp4"),
+		Path:         filepath.Join(workDir, "Song_cut.mp4"),
+	}
+	for _, path := range []string{clip.SourcePath, clip.Path} {
+		if err := os.WriteFile(path, []byte("video"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	destinations, err := pipeline.ApplyMessageTemplates([]config.Destination{{Name: "group", ChatID: "-100"}}, cfg, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(t.TempDir(), "out")
+	manifestPath, err := writeManifest(cfg, outDir, clip, pipeline.MessageData{Display: "Song"}, destinations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SourceVideo != "" {
+		t.Errorf("source video %q kept for unmoderated destinations", m.SourceVideo)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "Song.source.mp4")); !os.IsNotExist(err) {
+		t.Errorf("source video was copied: %v", err)
+	}
+}
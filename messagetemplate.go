@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadTemplateArg returns the template text of a -message-template value;
+// a leading "@" reads the template from a file.
+func loadTemplateArg(value string) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	data, err := os.ReadFile(value[1:])
+	if err != nil {
+		return "", fmt.Errorf("failed to read message template: %w", err)
+	}
+	return string(data), nil
+}
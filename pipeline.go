@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+// clipHistoryEntry returns the track details shared by every history entry of a clip.
+func clipHistoryEntry(c *pipeline.Clip) HistoryEntry {
+	return HistoryEntry{
+		SourceURL:  c.Request.URL,
+		YoutubeURL: c.Track.YoutubeURL,
+		YoutubeID:  youtubeVideoID(c.Track.YoutubeURL),
+		Title:      c.Track.Title,
+		Artist:     c.Track.Artist,
+		Start:      c.Request.Start,
+		Duration:   c.Request.Duration,
+	}
+}
+
+// deliverClip sends a finished clip to its destinations: moderated ones go to review, the
+// rest are queued for the daemon if publishAt is set or published right away. Destinations
+// that got the same track within the duplicate window are skipped unless force is set.
+// The link message is made from data, or from the clip if data is nil.
+// It returns how many destinations failed or were skipped and a short summary.
+func deliverClip(cfg *config.Config, pl *pipeline.Pipeline, clip *pipeline.Clip, data *pipeline.MessageData, destinations []config.Destination, publishAt time.Time, historyPath, queueDir string, force bool) (failed int, summary string) {
+	var notes []string
+	destinations, refused := filterDuplicates(cfg, historyPath, clipHistoryEntry(clip), destinations, force)
+	if len(refused) > 0 {
+		failed += len(refused)
+		notes = append(notes, fmt.Sprintf("duplicate for %d destination(s)", len(refused)))
+		for _, d := range refused {
+			events.failed(clip, d.Name, pipeline.StagePublish, exitPublish, "already posted within duplicate_window")
+		}
+	}
+
+	var messageData pipeline.MessageData
+	if data != nil {
+		messageData = *data
+	} else {
+		messageData = pl.MessageData(clip, cfg, destinations)
+	}
+	direct, moderated := splitModerated(cfg, destinations)
+
+	if len(moderated) > 0 {
+		job := &ScheduledJob{
+			PublishAt:    publishAt,
+			Destinations: moderated,
+			Data:         messageData,
+			Length:       pipeline.VideoNoteLength,
+			Duration:     clip.Request.Duration,
+			History:      clipHistoryEntry(clip),
+		}
+		if err := submitForReview(cfg, queueDir, job, clip.Path, clip.SourcePath, clip.FilenameBase); err != nil {
+			failed += len(moderated)
+			fmt.Printf("❌ Failed to submit clip for review: %s\n", logging.Redact(err.Error()))
+			events.failed(clip, "", pipeline.StagePublish, exitPublish, "failed to submit clip for review: "+err.Error())
+			notes = append(notes, "review failed")
+		} else {
+			events.scheduled(clip, job, true)
+			fmt.Printf("👀 Job %s sent to moderators for %s. It is published once approved.\n", job.ID, jobDestinationNames(job))
+			notes = append(notes, "in review as "+job.ID)
+		}
+	}
+	if len(direct) > 0 && !publishAt.IsZero() {
+		job := &ScheduledJob{
+			PublishAt:    publishAt,
+			Destinations: direct,
+			Data:         messageData,
+			Length:       pipeline.VideoNoteLength,
+			Duration:     clip.Request.Duration,
+			History:      clipHistoryEntry(clip),
+		}
+		if err := enqueueJob(queueDir, job, clip.Path, "", clip.FilenameBase); err != nil {
+			failed += len(direct)
+			fmt.Printf("❌ Failed to schedule clip: %s\n", logging.Redact(err.Error()))
+			events.failed(clip, "", pipeline.StagePublish, exitPublish, "failed to schedule clip: "+err.Error())
+			notes = append(notes, "scheduling failed")
+		} else {
+			events.scheduled(clip, job, false)
+			fmt.Printf("⏰ Scheduled job %s for %s. Run the daemon command to publish it.\n", job.ID, publishAt.Format(time.RFC3339))
+			notes = append(notes, fmt.Sprintf("scheduled as %s for %s", job.ID, publishAt.Format("2006-01-02 15:04")))
+		}
+	} else if len(direct) > 0 {
+		results := pl.Publish(direct, messageData, clip.Path, "", pipeline.VideoNoteLength, clip.Request.Duration)
+		failed += recordPublishResults(historyPath, clipHistoryEntry(clip), results)
+		var posted []string
+		for _, result := range results {
+			events.published(clip, result)
+			if result.Err == nil {
+				posted = append(posted, result.Destination.Name)
+			}
+		}
+		if len(posted) > 0 {
+			notes = append(notes, "posted to "+strings.Join(posted, ", "))
+		}
+		if len(posted) < len(results) {
+			notes = append(notes, fmt.Sprintf("%d of %d failed", len(results)-len(posted), len(results)))
+		}
+	}
+	return failed, strings.Join(notes, "; ")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Ma11doror/tgCircleGen/internal/transcode"
+)
+
+var previewCmd = &command{
+	name:    "preview",
+	args:    "[flags] <clip.mp4|manifest.json>",
+	summary: "render a clip with the round mask and a contact sheet of its frames",
+	about: "Shows a clip the way Telegram will: renders it with the video note's round mask as WebM\n" +
+		"with transparency, and a PNG contact sheet of masked frames taken across the clip. Takes a\n" +
+		"clip, such as one kept with make -r=false, or a manifest written by make -o.",
+	setup: setupPreview,
+}
+
+func setupPreview(fs *flag.FlagSet, _ *commonFlags) func(string) {
+	outputFlag := fs.String("o", "", "Directory for the preview files (default: next to the clip)")
+	columnsFlag := fs.Int("columns", transcode.DefaultSheet.Columns, "Frames per row of the contact sheet")
+	rowsFlag := fs.Int("rows", transcode.DefaultSheet.Rows, "Rows of the contact sheet")
+	openFlag := fs.Bool("open", false, "Open the preview with the system's default player")
+
+	return func(string) {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		if *columnsFlag < 1 || *rowsFlag < 1 {
+			fatal(exitUsage, "-columns and -rows must be at least 1")
+		}
+
+		clipPath := fs.Arg(0)
+		duration := 0
+		if strings.EqualFold(filepath.Ext(clipPath), ".json") {
+			m, err := loadManifest(clipPath)
+			if err != nil {
+				fatal(exitFailure, "Failed to load manifest", "err", err)
+			}
+			clipPath, duration = m.clipPath(fs.Arg(0)), m.Encoding.Duration
+		} else if _, err := os.Stat(clipPath); err != nil {
+			fatal(exitFailure, "Clip not found", "err", err)
+		}
+		if duration == 0 {
+			var err error
+			if duration, err = transcode.Duration(clipPath); err != nil {
+				fatal(exitEncode, "Failed to find the clip's duration", "err", err)
+			}
+		}
+
+		dir := *outputFlag
+		if dir == "" {
+			dir = filepath.Dir(clipPath)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			fatal(exitFailure, "Failed to create output directory", "err", err)
+		}
+		base := filepath.Join(dir, strings.TrimSuffix(filepath.Base(clipPath), filepath.Ext(clipPath)))
+		previewPath, sheetPath := base+"_preview.webm", base+"_sheet.png"
+
+		fmt.Println("Rendering the clip with the round mask...")
+		if err := transcode.Run(transcode.MaskCommand(clipPath, previewPath)); err != nil {
+			fatal(exitEncode, "Failed to render preview", "err", err)
+		}
+		fmt.Println("Rendering the contact sheet...")
+		sheet := transcode.DefaultSheet
+		sheet.Columns, sheet.Rows, sheet.Duration = *columnsFlag, *rowsFlag, duration
+		if err := transcode.Run(transcode.SheetCommand(clipPath, sheetPath, sheet)); err != nil {
+			fatal(exitEncode, "Failed to render contact sheet", "err", err)
+		}
+		fmt.Printf("\n✅ Preview: %s\n✅ Contact sheet: %s\n", previewPath, sheetPath)
+
+		if *openFlag {
+			if err := openFile(previewPath); err != nil {
+				slog.Warn("Failed to open the preview", "err", err)
+			}
+		}
+	}
+}
+
+// openFile opens path with the application the desktop associates with it.
+func openFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	return cmd.Start()
+}
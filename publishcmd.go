@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+var publishCmd = &command{
+	name:    "publish",
+	args:    "[flags] <manifest.json>...",
+	summary: "post clips written by make -o",
+	about: "Posts clips written by make -o, using the destinations and message data in their manifests.\n" +
+		"The clip must be next to its manifest; the directory can be copied to another machine.",
+	config: true,
+	events: true,
+	setup:  setupPublish,
+}
+
+func setupPublish(fs *flag.FlagSet, common *commonFlags) func(string) {
+	testFlag := fs.Bool("t", false, "Post to the test Telegram channel instead of the manifest's destinations")
+	var toFlag stringListFlag
+	fs.Var(&toFlag, "to", "Destination names from config.json, or \"all\", instead of the manifest's destinations (overrides -t)")
+	historyFlag := fs.String("history", defaultHistoryPath, "Path to the local history of posted video notes")
+	forceFlag := fs.Bool("force", false, "Post even if the track was already posted to a destination within duplicate_window")
+	var scheduleFlag string
+	fs.StringVar(&scheduleFlag, "at", "", "Queue the clips and publish them later via the daemon command (RFC 3339, \"2006-01-02 15:04\", \"15:04\" or \"+2h\")")
+	fs.StringVar(&scheduleFlag, "schedule", "", "Alias for -at")
+	queueFlag := fs.String("queue", defaultQueueDir, "Directory holding scheduled jobs")
+
+	return func(string) {
+		if fs.NArg() == 0 {
+			slog.Error("publish requires at least one manifest")
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+
+		cfg, _, err := common.loadConfig()
+		if err != nil {
+			fatal(exitFailure, "Failed to load config", "err", err)
+		}
+
+		var override []config.Destination
+		if len(toFlag) > 0 || *testFlag {
+			override, err = cfg.ResolveDestinations(toFlag, *testFlag)
+			if err == nil {
+				override, err = pipeline.ApplyMessageTemplates(override, cfg, "", "")
+			}
+			if err != nil {
+				fatal(exitUsage, "Invalid destinations", "err", err)
+			}
+		}
+
+		var publishAt time.Time
+		if scheduleFlag != "" {
+			publishAt, err = parseScheduleTime(scheduleFlag, time.Now())
+			if err != nil {
+				fatal(exitUsage, "Invalid schedule time", "err", err)
+			}
+			if !publishAt.After(time.Now()) {
+				fatal(exitUsage, "Schedule time is in the past", "at", publishAt.Format(time.RFC3339))
+			}
+		}
+
+		// Check every manifest first, so a bad one doesn't leave the others half posted.
+		manifests := make([]*Manifest, fs.NArg())
+		invalid := 0
+		for i, path := range fs.Args() {
+			if manifests[i], err = loadManifest(path); err != nil {
+				slog.Error("Invalid manifest", "err", err)
+				invalid++
+			}
+		}
+		if invalid > 0 {
+			fatal(exitFailure, "Manifests can't be published, nothing was posted", "invalid", invalid, "manifests", len(manifests))
+		}
+
+		pl := pipeline.New(cfg, "")
+		failed := 0
+		for i, m := range manifests {
+			path := fs.Arg(i)
+			destinations := override
+			if destinations == nil {
+				for _, d := range m.Destinations {
+					destinations = append(destinations, d.Destination)
+				}
+			}
+			if len(destinations) == 0 {
+				slog.Error("Manifest has no destinations; pass -to or -t", "manifest", path)
+				events.failed(m.pipelineClip(path), "", pipeline.StagePublish, exitPublish, path+" has no destinations")
+				failed++
+				continue
+			}
+			clip := m.pipelineClip(path)
+			if _, moderated := splitModerated(cfg, destinations); len(moderated) > 0 && clip.SourcePath == "" {
+				// Review jobs keep the source video so moderators can re-cut the clip.
+				slog.Error("Manifest has no source video, which moderated destinations need; make the clip again with make -o", "manifest", path)
+				events.failed(clip, "", pipeline.StagePublish, exitPublish, path+" has no source video for moderated destinations")
+				failed++
+				continue
+			}
+			fmt.Printf("📤 Publishing %s from %s\n", m.Source.Display, path)
+			destFailed, _ := deliverClip(cfg, pl, clip, &m.Data, destinations, publishAt, *historyFlag, *queueFlag, *forceFlag)
+			if destFailed > 0 {
+				failed++
+			}
+		}
+		if failed > 0 {
+			fatal(exitPublish, "Publishing failed", "failed", failed, "manifests", len(manifests))
+		}
+	}
+}
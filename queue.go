@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+)
+
+const defaultQueueDir = "queue"
+
+const (
+	JobAwaitingReview = "review"
+	JobPending        = "pending"
+	JobPublished      = "published"
+	JobFailed         = "failed"
+	JobCancelled      = "cancelled"
+	JobRejected       = "rejected"
+)
+
+const (
+	jobFileName    = "job.json"
+	jobClipName    = "clip.mp4"
+	jobSourceName  = "source.mp4"
+	maxJobAttempts = 3
+	// Job IDs end up in callback_data, which Telegram limits to 64 bytes.
+	maxJobNameHint = 32
+)
+
+// ScheduledJob is a rendered clip waiting in the local queue to be published at PublishAt.
+// Each job lives in its own directory under the queue dir, next to a copy of the clip.
+type ScheduledJob struct {
+	ID           string               `json:"id"`
+	CreatedAt    time.Time            `json:"created_at"`
+	PublishAt    time.Time            `json:"publish_at"`
+	Status       string               `json:"status"`
+	Destinations []config.Destination `json:"destinations"`
+	Data         pipeline.MessageData `json:"data"`
+	Length       int                  `json:"length"`
+	Duration     int                  `json:"duration"`
+	History      HistoryEntry         `json:"history"`
+	Attempts     int                  `json:"attempts,omitempty"`
+	LastError    string               `json:"last_error,omitempty"`
+	PublishedAt  *time.Time           `json:"published_at,omitempty"`
+
+	// Review state, used when the job's destinations require moderator approval.
+	FileID          string `json:"file_id,omitempty"`
+	ReviewChatID    string `json:"review_chat_id,omitempty"`
+	ReviewMessageID int    `json:"review_message_id,omitempty"`
+	ReviewedBy      string `json:"reviewed_by,omitempty"`
+	RejectReason    string `json:"reject_reason,omitempty"`
+
+	dir string
+}
+
+func (j *ScheduledJob) ClipPath() string {
+	return filepath.Join(j.dir, jobClipName)
+}
+
+// SourcePath is the full downloaded video, kept only for jobs that may need to be re-cut.
+func (j *ScheduledJob) SourcePath() string {
+	return filepath.Join(j.dir, jobSourceName)
+}
+
+// removeMedia deletes the job's video files once they are no longer needed.
+func (j *ScheduledJob) removeMedia() error {
+	for _, path := range []string{j.ClipPath(), j.SourcePath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove media of job %s: %w", j.ID, err)
+		}
+	}
+	return nil
+}
+
+// parseScheduleTime accepts an RFC 3339 timestamp, a local "2006-01-02 15:04" date and time,
+// a local "15:04" time (today, or tomorrow if it has already passed) or a "+90m" style offset.
+func parseScheduleTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "+") {
+		offset, err := time.ParseDuration(value[1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid schedule offset %q: %w", value, err)
+		}
+		return now.Add(offset), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid schedule time %q (expected RFC 3339, \"2006-01-02 15:04\", \"15:04\" or \"+1h30m\")", value)
+}
+
+// enqueueJob copies the clip, and the source video if sourcePath is set, into a new job
+// directory and stores the job. Jobs without a status are stored as pending.
+func enqueueJob(queueDir string, job *ScheduledJob, clipPath, sourcePath, nameHint string) error {
+	for len(nameHint) > maxJobNameHint {
+		_, size := utf8.DecodeLastRuneInString(nameHint)
+		nameHint = nameHint[:len(nameHint)-size]
+	}
+	stamp := job.PublishAt
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	base := stamp.Format("20060102-1504") + "_" + nameHint
+	id := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(queueDir, id)); os.IsNotExist(err) {
+			break
+		}
+		id = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	job.ID = id
+	if job.Status == "" {
+		job.Status = JobPending
+	}
+	job.CreatedAt = time.Now()
+	job.dir = filepath.Join(queueDir, id)
+
+	if err := os.MkdirAll(job.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create job directory %s: %w", job.dir, err)
+	}
+	if err := copyFile(clipPath, job.ClipPath()); err != nil {
+		os.RemoveAll(job.dir)
+		return fmt.Errorf("failed to copy clip into queue: %w", err)
+	}
+	if sourcePath != "" {
+		if err := copyFile(sourcePath, job.SourcePath()); err != nil {
+			os.RemoveAll(job.dir)
+			return fmt.Errorf("failed to copy source video into queue: %w", err)
+		}
+	}
+	if err := saveJob(job); err != nil {
+		os.RemoveAll(job.dir)
+		return err
+	}
+	return nil
+}
+
+// saveJob writes job.json atomically so a crash never leaves a half-written job behind.
+func saveJob(job *ScheduledJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+	tmpPath := filepath.Join(job.dir, jobFileName+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(job.dir, jobFileName)); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func loadJob(queueDir, id string) (*ScheduledJob, error) {
+	dir := filepath.Join(queueDir, id)
+	data, err := os.ReadFile(filepath.Join(dir, jobFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %w", id, err)
+	}
+	var job ScheduledJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+	}
+	job.dir = dir
+	return &job, nil
+}
+
+// loadJobs returns all jobs in the queue ordered by publish time.
+func loadJobs(queueDir string) ([]*ScheduledJob, error) {
+	dirEntries, err := os.ReadDir(queueDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue directory %s: %w", queueDir, err)
+	}
+
+	var jobs []*ScheduledJob
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		job, err := loadJob(queueDir, dirEntry.Name())
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].PublishAt.Before(jobs[k].PublishAt)
+	})
+	return jobs, nil
+}
+
+// cancelJob marks a pending or in-review job as cancelled and removes its media.
+func cancelJob(queueDir, id string) error {
+	job, err := loadJob(queueDir, id)
+	if err != nil {
+		return err
+	}
+	if job.Status != JobPending && job.Status != JobAwaitingReview {
+		return fmt.Errorf("job %s is %s, only pending jobs can be cancelled", id, job.Status)
+	}
+	job.Status = JobCancelled
+	if err := saveJob(job); err != nil {
+		return err
+	}
+	return job.removeMedia()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/logging"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+var repostCmd = &command{
+	name:    "repost",
+	args:    "[flags]",
+	summary: "send an already posted video note again without re-encoding",
+	about:   "Sends an existing video note to a chat by file_id, without downloading or re-encoding.",
+	config:  true,
+	setup:   setupRepost,
+}
+
+// setupRepost sends an already uploaded video note to a chat by its file_id,
+// skipping download and encoding entirely.
+func setupRepost(fs *flag.FlagSet, common *commonFlags) func(string) {
+	fileIDFlag := fs.String("file-id", "", "Telegram file_id of the video note (default: the most recent one in history)")
+	chatFlag := fs.String("chat", "", "Target chat ID or @channel (overrides config)")
+	testFlag := fs.Bool("t", false, "Use the test Telegram channel")
+	var toFlag stringListFlag
+	fs.Var(&toFlag, "to", "Comma-separated destination names from config.json, or \"all\" (can be repeated)")
+	linkFlag := fs.Bool("link", true, "Also resend the link message recorded in history")
+	historyFlag := fs.String("history", defaultHistoryPath, "Path to the local history of posted video notes")
+	forceFlag := fs.Bool("force", false, "Post even if the video note was already posted to a destination within duplicate_window")
+
+	return func(string) {
+		cfg, _, err := common.loadConfig()
+		if err != nil {
+			fatal(exitFailure, "Failed to load config", "err", err)
+		}
+		tg := cfg.TelegramClient()
+
+		var destinations []config.Destination
+		if *chatFlag != "" {
+			destinations = []config.Destination{{Name: *chatFlag, ChatID: *chatFlag, Moderated: isModeratedChat(cfg, *chatFlag)}}
+		} else {
+			destinations, err = cfg.ResolveDestinations(toFlag, *testFlag)
+			if err != nil {
+				fatal(exitUsage, "Invalid destinations", "err", err)
+			}
+			if len(toFlag) == 0 && *testFlag {
+				fmt.Println("🚀 Using TEST channel.")
+			}
+		}
+
+		entries, err := loadHistory(*historyFlag)
+		if err != nil {
+			fatal(exitFailure, "Failed to load history", "err", err)
+		}
+
+		fileID := *fileIDFlag
+		var entry HistoryEntry
+		var found bool
+		if fileID == "" {
+			for i := len(entries) - 1; i >= 0 && !found; i-- {
+				if entries[i].Published() {
+					entry, found = entries[i], true
+				}
+			}
+			if !found {
+				fatal(exitFailure, "-file-id not given and history has no published entries", "history", *historyFlag)
+			}
+			fileID = entry.FileID
+			slog.Info("Using the most recent history entry", "title", entry.Title, "artist", entry.Artist, "file_id", fileID)
+		} else {
+			entry, found = findHistoryByFileID(entries, fileID)
+		}
+
+		total := len(destinations)
+		failed := 0
+		// Moderated chats only get what a moderator approved, and a repost can't be reviewed.
+		direct, moderated := splitModerated(cfg, destinations)
+		if len(moderated) > 0 && !approvedByModerator(entries, fileID) {
+			for _, d := range moderated {
+				failed++
+				fmt.Printf("❌ %s (%s): only clips approved by a moderator are posted there, and this video note was not\n", d.Name, d.ChatID)
+			}
+			destinations = direct
+		}
+		if found {
+			var refused []config.Destination
+			destinations, refused = filterDuplicates(cfg, *historyFlag, entry, destinations, *forceFlag)
+			failed += len(refused)
+		}
+		for _, d := range destinations {
+			opts := d.SendOptions()
+			var linkMessageID int
+			if *linkFlag && found && entry.MessageText != "" {
+				parseMode := entry.ParseMode
+				if parseMode == "" {
+					parseMode = telegram.ParseModeMarkdownV2
+				}
+				linkMessage, err := tg.SendMessage(d.ChatID, entry.MessageText, parseMode, true, opts)
+				if err != nil {
+					failed++
+					fmt.Printf("❌ %s (%s): failed to send link message: %s\n", d.Name, d.ChatID, logging.Redact(err.Error()))
+					continue
+				}
+				linkMessageID = linkMessage.MessageID
+			}
+
+			message, err := tg.SendVideoNoteByFileID(d.ChatID, fileID, opts)
+			if err != nil {
+				failed++
+				fmt.Printf("❌ %s (%s): failed to repost video note: %s\n", d.Name, d.ChatID, logging.Redact(err.Error()))
+				continue
+			}
+			fmt.Printf("✅ %s (%s): video note %d reposted\n", d.Name, d.ChatID, message.MessageID)
+
+			if found {
+				reposted := entry
+				reposted.Destination = d.Name
+				reposted.ChatID = d.ChatID
+				reposted.MessageID = message.MessageID
+				reposted.LinkMessageID = linkMessageID
+				reposted.PostedAt = time.Now()
+				if err := appendHistory(*historyFlag, reposted); err != nil {
+					slog.Warn("Failed to record history", "destination", d.Name, "err", err)
+				}
+			}
+		}
+
+		if failed > 0 {
+			fatal(exitPublish, "Repost failed", "failed", failed, "destinations", total)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/pipeline"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+// splitModerated separates the destinations that need a moderator's approval from those
+// that can be posted to straight away.
+func splitModerated(cfg *config.Config, destinations []config.Destination) (direct, moderated []config.Destination) {
+	if !cfg.Moderation.Enabled() {
+		return destinations, nil
+	}
+	for _, d := range destinations {
+		if d.Moderated {
+			moderated = append(moderated, d)
+		} else {
+			direct = append(direct, d)
+		}
+	}
+	return direct, moderated
+}
+
+// isModeratedChat reports whether posts to chatID need a moderator's approval: it is
+// chat_id or the chat of a moderated destination, and moderation is configured.
+func isModeratedChat(cfg *config.Config, chatID string) bool {
+	if !cfg.Moderation.Enabled() {
+		return false
+	}
+	if chatID == cfg.ChatID {
+		return true
+	}
+	for _, d := range cfg.Destinations {
+		if d.Moderated && d.ChatID == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+func reviewKeyboard(jobID string) *telegram.InlineKeyboardMarkup {
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+		{Text: "✅ Approve", CallbackData: "rv-ok:" + jobID},
+		{Text: "❌ Reject", CallbackData: "rv-no:" + jobID},
+		{Text: "✂️ Re-cut", CallbackData: "rv-cut:" + jobID},
+	}}}
+}
+
+// submitForReview stores the job in the queue as awaiting review and posts it to the
+// moderators' chat. sourcePath is kept with the job so moderators can ask for a re-cut.
+func submitForReview(cfg *config.Config, queueDir string, job *ScheduledJob, clipPath, sourcePath, nameHint string) error {
+	job.Status = JobAwaitingReview
+	if err := enqueueJob(queueDir, job, clipPath, sourcePath, nameHint); err != nil {
+		return err
+	}
+	return sendReviewPreview(cfg, job)
+}
+
+func jobDestinationNames(job *ScheduledJob) string {
+	names := make([]string, 0, len(job.Destinations))
+	for _, d := range job.Destinations {
+		names = append(names, d.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// sendReviewPreview posts a summary, the link message and the circle with the review buttons
+// to the moderators' chat. The uploaded circle's file_id is reused when the job is published.
+func sendReviewPreview(cfg *config.Config, job *ScheduledJob) error {
+	tg := cfg.TelegramClient()
+	chat := cfg.Moderation.ChatID
+
+	summary := fmt.Sprintf("🆕 For review: %s\nTo: %s\nStart %s, %d seconds", job.Data.Display, jobDestinationNames(job), pipeline.FormatDuration(job.History.Start), job.Duration)
+	if !job.PublishAt.IsZero() {
+		summary += "\nScheduled for " + job.PublishAt.Local().Format("2006-01-02 15:04")
+	}
+	if _, err := tg.SendMessage(chat, summary, "", true, telegram.SendOptions{}); err != nil {
+		return fmt.Errorf("failed to send review summary: %w", err)
+	}
+
+	first := job.Destinations[0]
+	if text, err := pipeline.RenderMessage(first.MessageTemplate, first.ParseMode, job.Data); err == nil {
+		if _, err := tg.SendMessage(chat, text, first.ParseMode, true, telegram.SendOptions{}); err != nil {
+			slog.Warn("Failed to send review message preview", "queue_job", job.ID, "err", err)
+		}
+	}
+
+	message, err := tg.SendVideoNote(chat, job.ClipPath(), job.Length, job.Duration, telegram.SendOptions{ReplyMarkup: reviewKeyboard(job.ID)})
+	if err != nil {
+		return fmt.Errorf("failed to send review video note: %w", err)
+	}
+	job.ReviewChatID = chat
+	job.ReviewMessageID = message.MessageID
+	if message.VideoNote != nil {
+		job.FileID = message.VideoNote.FileID
+	}
+	return saveJob(job)
+}
+
+const (
+	promptRejectReason = iota + 1
+	promptRecut
+)
+
+// reviewPrompt is a force-reply question the bot asked in the moderators' chat.
+type reviewPrompt struct {
+	kind  int
+	jobID string
+}
+
+func userDisplayName(user telegram.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return fmt.Sprintf("%s (%d)", user.FirstName, user.ID)
+}
+
+func (b *Bot) isModerator(user telegram.User, chatID int64) bool {
+	if len(b.cfg.Moderation.Moderators) > 0 {
+		return slices.Contains(b.cfg.Moderation.Moderators, user.ID)
+	}
+	return strconv.FormatInt(chatID, 10) == b.cfg.Moderation.ChatID
+}
+
+func (b *Bot) handleReviewCallback(query *telegram.CallbackQuery, action, jobID string) {
+	if query.Message == nil || !b.isModerator(query.From, query.Message.Chat.ID) {
+		b.answerCallback(query.ID, "Only moderators can review clips.")
+		return
+	}
+
+	job, err := loadJob(b.queueDir, jobID)
+	if err != nil {
+		b.answerCallback(query.ID, "This clip is no longer in the queue.")
+		return
+	}
+	if job.Status != JobAwaitingReview {
+		b.answerCallback(query.ID, fmt.Sprintf("This clip is already %s.", job.Status))
+		return
+	}
+	if b.reviewing[job.ID] {
+		b.answerCallback(query.ID, "This clip is being worked on, try again in a moment.")
+		return
+	}
+
+	chatID := query.Message.Chat.ID
+	switch action {
+	case "rv-ok":
+		b.answerCallback(query.ID, "Approved.")
+		b.approveJob(job, userDisplayName(query.From))
+	case "rv-no":
+		b.answerCallback(query.ID, "")
+		b.askModerator(chatID, job, promptRejectReason, "Why is this clip rejected? Reply with the reason.", "Reason")
+	case "rv-cut":
+		b.answerCallback(query.ID, "")
+		b.askModerator(chatID, job, promptRecut, "Reply with the new start and duration, e.g. 1:25 30.", "1:25 30")
+	default:
+		b.answerCallback(query.ID, "Unknown action.")
+	}
+}
+
+func (b *Bot) askModerator(chatID int64, job *ScheduledJob, kind int, question, placeholder string) {
+	opts := telegram.SendOptions{
+		ReplyToMessageID: job.ReviewMessageID,
+		ReplyMarkup:      &telegram.ForceReply{ForceReply: true, InputFieldPlaceholder: placeholder},
+	}
+	prompt, err := b.reply(chatID, question, opts)
+	if err != nil {
+		return
+	}
+	b.reviewPrompts[prompt.MessageID] = reviewPrompt{kind: kind, jobID: job.ID}
+}
+
+// handleModeratorReply handles answers to reviewPrompts. It reports whether msg was one.
+func (b *Bot) handleModeratorReply(msg *telegram.Message) bool {
+	if msg.ReplyToMessage == nil {
+		return false
+	}
+	prompt, ok := b.reviewPrompts[msg.ReplyToMessage.MessageID]
+	if !ok {
+		return false
+	}
+	if msg.From == nil || !b.isModerator(*msg.From, msg.Chat.ID) {
+		return true
+	}
+
+	job, err := loadJob(b.queueDir, prompt.jobID)
+	if err != nil || job.Status != JobAwaitingReview {
+		delete(b.reviewPrompts, msg.ReplyToMessage.MessageID)
+		b.reply(msg.Chat.ID, "This clip is no longer awaiting review.", telegram.SendOptions{})
+		return true
+	}
+	if b.reviewing[job.ID] {
+		b.reply(msg.Chat.ID, "This clip is being worked on, reply again in a moment.", telegram.SendOptions{})
+		return true
+	}
+
+	switch prompt.kind {
+	case promptRejectReason:
+		reason := strings.TrimSpace(msg.Text)
+		if reason == "" {
+			reason = "no reason given"
+		}
+		delete(b.reviewPrompts, msg.ReplyToMessage.MessageID)
+		b.rejectJob(job, userDisplayName(*msg.From), reason)
+	case promptRecut:
+		fields := strings.Fields(msg.Text)
+		if len(fields) != 2 {
+			b.reply(msg.Chat.ID, "Please reply with exactly two values: start and duration, e.g. 1:25 30.", telegram.SendOptions{})
+			return true
+		}
+		start, err := pipeline.ParseTimestamp(fields[0])
+		if err != nil {
+			b.reply(msg.Chat.ID, fmt.Sprintf("I couldn't read the start time %q.", fields[0]), telegram.SendOptions{})
+			return true
+		}
+		seconds, err := strconv.Atoi(fields[1])
+		if err != nil {
+			b.reply(msg.Chat.ID, fmt.Sprintf("I couldn't read the duration %q.", fields[1]), telegram.SendOptions{})
+			return true
+		}
+		duration, _, err := pipeline.ClampDuration(seconds)
+		if err != nil {
+			b.reply(msg.Chat.ID, fmt.Sprintf("The duration must be from %d to %d seconds.", pipeline.MinClipDuration, pipeline.MaxClipDuration), telegram.SendOptions{})
+			return true
+		}
+		delete(b.reviewPrompts, msg.ReplyToMessage.MessageID)
+		b.recutJob(job, start, duration)
+	}
+	return true
+}
+
+// approveJob publishes an approved job now, or leaves it to the daemon if it is scheduled
+// for later. Destinations that fail are handed to the daemon to retry.
+func (b *Bot) approveJob(job *ScheduledJob, moderator string) {
+	chatID, _ := strconv.ParseInt(job.ReviewChatID, 10, 64)
+	b.setKeyboardOn(chatID, job.ReviewMessageID, &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{}})
+
+	job.ReviewedBy = moderator
+	job.History.ReviewedBy = moderator
+	if job.PublishAt.After(time.Now()) {
+		job.Status = JobPending
+		if err := saveJob(job); err != nil {
+			slog.Warn("Failed to save job", "queue_job", job.ID, "err", err)
+		}
+		b.reply(chatID, fmt.Sprintf("✅ Approved by %s, the daemon will publish it at %s.", moderator, job.PublishAt.Local().Format("2006-01-02 15:04")), telegram.SendOptions{})
+		return
+	}
+
+	b.reviewing[job.ID] = true
+	b.spawn(func() {
+		defer b.doneReviewing(job.ID)
+		b.publishApproved(job, chatID, moderator)
+	})
+}
+
+// publishApproved publishes an approved job and reports the outcome in the moderators' chat.
+// It runs without holding mu.
+func (b *Bot) publishApproved(job *ScheduledJob, chatID int64, moderator string) {
+	results := b.pipeline.Publish(job.Destinations, job.Data, job.ClipPath(), job.FileID, job.Length, job.Duration)
+	recordPublishResults(b.historyPath, job.History, results)
+
+	var remaining []config.Destination
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Approved by %s:\n", moderator)
+	for _, result := range results {
+		if result.Err != nil {
+			remaining = append(remaining, result.Destination)
+			fmt.Fprintf(&sb, "❌ %s: %v\n", result.Destination.Name, result.Err)
+		} else {
+			fmt.Fprintf(&sb, "✅ %s\n", result.Destination.Name)
+		}
+	}
+
+	if len(remaining) == 0 {
+		publishedAt := time.Now()
+		job.Status = JobPublished
+		job.PublishedAt = &publishedAt
+		if err := job.removeMedia(); err != nil {
+			slog.Warn("Failed to remove job media", "queue_job", job.ID, "err", err)
+		}
+	} else {
+		job.Status = JobPending
+		job.Destinations = remaining
+		job.Attempts++
+		sb.WriteString("The daemon will retry the failed destinations.")
+	}
+	if err := saveJob(job); err != nil {
+		slog.Warn("Failed to save job", "queue_job", job.ID, "err", err)
+	}
+	b.reply(chatID, strings.TrimSpace(sb.String()), telegram.SendOptions{})
+}
+
+// rejectJob drops the job and records the rejection and its reason in history.
+func (b *Bot) rejectJob(job *ScheduledJob, moderator, reason string) {
+	chatID, _ := strconv.ParseInt(job.ReviewChatID, 10, 64)
+	b.setKeyboardOn(chatID, job.ReviewMessageID, &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{}})
+
+	job.Status = JobRejected
+	job.ReviewedBy = moderator
+	job.RejectReason = reason
+	if err := saveJob(job); err != nil {
+		slog.Warn("Failed to save job", "queue_job", job.ID, "err", err)
+	}
+	if err := job.removeMedia(); err != nil {
+		slog.Warn("Failed to remove job media", "queue_job", job.ID, "err", err)
+	}
+
+	entry := job.History
+	entry.PostedAt = time.Now()
+	entry.ChatID = job.ReviewChatID
+	entry.MessageID = job.ReviewMessageID
+	entry.FileID = job.FileID
+	entry.Status = HistoryRejected
+	entry.RejectReason = reason
+	entry.ReviewedBy = moderator
+	if err := appendHistory(b.historyPath, entry); err != nil {
+		slog.Warn("Failed to record history", "queue_job", job.ID, "err", err)
+	}
+	b.reply(chatID, fmt.Sprintf("❌ Rejected by %s: %s", moderator, reason), telegram.SendOptions{})
+}
+
+// recutJob cuts the job's clip again from its stored source and posts a fresh review
+// preview, in the background.
+func (b *Bot) recutJob(job *ScheduledJob, start, duration int) {
+	chatID, _ := strconv.ParseInt(job.ReviewChatID, 10, 64)
+	b.reply(chatID, fmt.Sprintf("⏳ Re-cutting: %d seconds from %s…", duration, pipeline.FormatDuration(start)), telegram.SendOptions{})
+
+	b.reviewing[job.ID] = true
+	b.spawn(func() {
+		defer b.doneReviewing(job.ID)
+		b.recutReviewed(job, chatID, start, duration)
+	})
+}
+
+func (b *Bot) doneReviewing(jobID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.reviewing, jobID)
+}
+
+// recutReviewed does the work of recutJob. It runs without holding mu.
+func (b *Bot) recutReviewed(job *ScheduledJob, chatID int64, start, duration int) {
+	if err := b.pool.Encode(func() error {
+		return b.pipeline.Transcoder.Cut(job.SourcePath(), job.ClipPath(), start, duration, nil)
+	}); err != nil {
+		slog.Error("Re-cut failed", "queue_job", job.ID, "stage", pipeline.StageEncode, "err", err)
+		b.reply(chatID, fmt.Sprintf("❌ Re-cut failed: %v", err), telegram.SendOptions{})
+		return
+	}
+	b.setKeyboardOn(chatID, job.ReviewMessageID, &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{}})
+
+	job.Duration = duration
+	job.History.Start, job.History.Duration = start, duration
+	job.Data.Start, job.Data.DurationSeconds = start, duration
+	if err := sendReviewPreview(b.cfg, job); err != nil {
+		slog.Error("Failed to send re-cut preview", "queue_job", job.ID, "err", err)
+		b.reply(chatID, fmt.Sprintf("❌ Failed to send the new preview: %v", err), telegram.SendOptions{})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+func TestIsModeratedChat(t *testing.T) {
+	cfg := &config.Config{
+		ChatID:     "@channel",
+		ChatIDTest: "@test",
+		Destinations: []config.Destination{
+			{Name: "group", ChatID: "-100", Moderated: true},
+			{Name: "other", ChatID: "-200"},
+		},
+		Moderation: config.ModerationConfig{ChatID: "-300"},
+	}
+	tests := []struct {
+		chatID string
+		want   bool
+	}{
+		{"@channel", true},
+		{"-100", true},
+		{"-200", false},
+		{"@test", false},
+		{"@elsewhere", false},
+	}
+	for _, tt := range tests {
+		if got := isModeratedChat(cfg, tt.chatID); got != tt.want {
+			t.Errorf("isModeratedChat(%q) = %v, want %v", tt.chatID, got, tt.want)
+		}
+	}
+
+	cfg.Moderation.ChatID = ""
+	if isModeratedChat(cfg, "@channel") {
+		t.Error("chat_id is moderated without a moderation section")
+	}
+}
+
+// blockingTranscoder is a Transcoder whose cuts wait until release is closed.
+type blockingTranscoder struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingTranscoder() *blockingTranscoder {
+	return &blockingTranscoder{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (tc *blockingTranscoder) Cut(input, output string, start, duration int, progress func(float64)) error {
+	tc.started <- struct{}{}
+	<-tc.release
+	return os.WriteFile(output, []byte("re-cut"), 0o644)
+}
+
+// handleSoon handles update and fails the test if that takes longer than a second, which
+// it would if the bot held its lock during a blocked encode.
+func handleSoon(t *testing.T, bot *Bot, update telegram.Update) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		bot.handleUpdate(update)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handling an update blocked")
+	}
+}
+
+func TestRecutJobDoesNotBlockUpdates(t *testing.T) {
+	bot, srv := newTestBot(t)
+	bot.cfg.Moderation.ChatID = "-300"
+	transcoder := newBlockingTranscoder()
+	bot.pipeline.Transcoder = transcoder
+
+	dir := t.TempDir()
+	clipPath, sourcePath := filepath.Join(dir, "clip.mp4"), filepath.Join(dir, "source.mp4")
+	for _, path := range []string{clipPath, sourcePath} {
+		if err := os.WriteFile(path, []byte("video"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	job := &ScheduledJob{
+		Status:          JobAwaitingReview,
+		Destinations:    []config.Destination{{Name: "main", ChatID: "@channel", Moderated: true}},
+		Length:          384,
+		Duration:        30,
+		ReviewChatID:    "-300",
+		ReviewMessageID: 5,
+	}
+	if err := enqueueJob(bot.queueDir, job, clipPath, sourcePath, "song"); err != nil {
+		t.Fatal(err)
+	}
+	bot.reviewPrompts[100] = reviewPrompt{kind: promptRecut, jobID: job.ID}
+
+	moderators := telegram.Chat{ID: -300, Type: "supergroup"}
+	handleSoon(t, bot, telegram.Update{Message: &telegram.Message{
+		MessageID:      101,
+		From:           &telegram.User{ID: 7, FirstName: "Mod"},
+		Chat:           moderators,
+		Text:           "1:00 20",
+		ReplyToMessage: &telegram.Message{MessageID: 100, Chat: moderators},
+	}})
+	<-transcoder.started
+
+	// While the re-cut is encoding, other updates are handled and the job takes no other action.
+	handleSoon(t, bot, privateMessage(testUserID, "/help"))
+	handleSoon(t, bot, telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:      "cb",
+		From:    telegram.User{ID: 7, FirstName: "Mod"},
+		Message: &telegram.Message{MessageID: 5, Chat: moderators},
+		Data:    "rv-ok:" + job.ID,
+	}})
+	answers := srv.Requests("answerCallbackQuery")
+	if len(answers) != 1 || answers[0].Params.Get("text") != "This clip is being worked on, try again in a moment." {
+		t.Errorf("approving during a re-cut was answered with %v", answers)
+	}
+
+	close(transcoder.release)
+	bot.wg.Wait()
+
+	if notes := srv.Requests("sendVideoNote"); len(notes) != 1 || notes[0].Params.Get("chat_id") != "-300" {
+		t.Fatalf("got %d review previews, want one in the moderators' chat", len(notes))
+	}
+	saved, err := loadJob(bot.queueDir, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Duration != 20 || saved.History.Start != 60 || saved.Status != JobAwaitingReview {
+		t.Errorf("job after re-cut: duration %d, start %d, status %s", saved.Duration, saved.History.Start, saved.Status)
+	}
+	if bot.reviewing[job.ID] {
+		t.Error("job still marked as being worked on")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+)
+
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookHandler accepts updates pushed by Telegram. Updates are handed to a channel and
+// acknowledged right away, since making a circle takes far longer than Telegram waits.
+type webhookHandler struct {
+	secret  string
+	updates chan<- telegram.Update
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(h.secret)) != 1 {
+		slog.Warn("Rejected webhook request with a wrong secret token", "remote_addr", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update telegram.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&update); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	default:
+		// Telegram retries on errors, so a full queue only delays the update.
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func setWebhook(ctx context.Context, tg *telegram.Client, webhookURL, secret string) error {
+	params := url.Values{}
+	params.Add("url", webhookURL)
+	params.Add("secret_token", secret)
+	params.Add("allowed_updates", botAllowedUpdates)
+	return tg.Call(ctx, "setWebhook", params, nil)
+}
+
+func deleteWebhook(ctx context.Context, tg *telegram.Client) error {
+	return tg.Call(ctx, "deleteWebhook", url.Values{}, nil)
+}
+
+// serveWebhook registers webhookURL with Telegram and serves updates on listenAddr until
+// ctx is cancelled. Updates are processed one at a time by the same handler as polling.
+func (b *Bot) serveWebhook(ctx context.Context, listenAddr, webhookURL, secret string) error {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	return b.serveWebhookOn(ctx, listener, webhookURL, secret)
+}
+
+// serveWebhookOn is serveWebhook on a listener that is already open. It closes listener.
+func (b *Bot) serveWebhookOn(ctx context.Context, listener net.Listener, webhookURL, secret string) error {
+	path := "/"
+	if parsed, err := url.Parse(webhookURL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		listener.Close()
+		return fmt.Errorf("webhook URL %q must be an absolute https URL", webhookURL)
+	} else if parsed.Path != "" {
+		path = parsed.Path
+	}
+
+	updates := make(chan telegram.Update, 100)
+	mux := http.NewServeMux()
+	mux.Handle(path, &webhookHandler{secret: secret, updates: updates})
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	if err := setWebhook(ctx, b.tg, webhookURL, secret); err != nil {
+		server.Close()
+		return err
+	}
+	fmt.Printf("🌐 Webhook %s registered, listening on %s%s\n", webhookURL, listener.Addr(), path)
+
+	for {
+		select {
+		case update := <-updates:
+			b.handleUpdate(update)
+		case err := <-serveErr:
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return server.Shutdown(shutdownCtx)
+		}
+	}
+}
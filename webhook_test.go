@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ma11doror/tgCircleGen/internal/config"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram"
+	"github.com/Ma11doror/tgCircleGen/internal/telegram/telegramtest"
+)
+
+const testUserID = 42
+
+// newTestBot starts a fake Bot API and a bot talking to it that allows testUserID and
+// publishes to @channel.
+func newTestBot(t *testing.T) (*Bot, *telegramtest.Server) {
+	t.Helper()
+	srv := telegramtest.NewServer("123:abc")
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		BotToken: srv.Token,
+		APIURL:   srv.URL,
+		ChatID:   "@channel",
+		Bot: config.BotConfig{
+			AllowedUsers: []int64{testUserID},
+			WorkDir:      filepath.Join(dir, "work"),
+		},
+	}
+	bot, err := newBot(cfg, "", filepath.Join(dir, "history.jsonl"), filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatalf("newBot: %v", err)
+	}
+	return bot, srv
+}
+
+// privateMessage is an update with text sent to the bot by userID.
+func privateMessage(userID int64, text string) telegram.Update {
+	return telegram.Update{UpdateID: 1, Message: &telegram.Message{
+		MessageID: 1,
+		From:      &telegram.User{ID: userID, FirstName: "Test"},
+		Chat:      telegram.Chat{ID: userID, Type: "private"},
+		Text:      text,
+	}}
+}
+
+func TestSetWebhook(t *testing.T) {
+	srv := telegramtest.NewServer("123:abc")
+	defer srv.Close()
+
+	if err := setWebhook(context.Background(), srv.Client(), "https://example.com/hook", "s3cret"); err != nil {
+		t.Fatalf("setWebhook: %v", err)
+	}
+	calls := srv.Requests("setWebhook")
+	if len(calls) != 1 {
+		t.Fatalf("got %d setWebhook calls, want 1", len(calls))
+	}
+	p := calls[0].Params
+	if got := p.Get("url"); got != "https://example.com/hook" {
+		t.Errorf("url = %q", got)
+	}
+	if got := p.Get("secret_token"); got != "s3cret" {
+		t.Errorf("secret_token = %q", got)
+	}
+	if got := p.Get("allowed_updates"); got != botAllowedUpdates {
+		t.Errorf("allowed_updates = %q, want %q", got, botAllowedUpdates)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	body, err := json.Marshal(privateMessage(testUserID, "/help"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   []byte
+		want   int
+		queued bool
+	}{
+		{"update", http.MethodPost, "s3cret", body, http.StatusOK, true},
+		{"wrong secret", http.MethodPost, "guess", body, http.StatusForbidden, false},
+		{"no secret", http.MethodPost, "", body, http.StatusForbidden, false},
+		{"get", http.MethodGet, "s3cret", nil, http.StatusMethodNotAllowed, false},
+		{"bad json", http.MethodPost, "s3cret", []byte("{"), http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan telegram.Update, 1)
+			handler := &webhookHandler{secret: "s3cret", updates: updates}
+
+			req := httptest.NewRequest(tt.method, "/hook", bytes.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(webhookSecretHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := len(updates) == 1; got != tt.queued {
+				t.Errorf("update queued = %v, want %v", got, tt.queued)
+			}
+		})
+	}
+}
+
+func TestServeWebhookDispatchesUpdates(t *testing.T) {
+	bot, srv := newTestBot(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- bot.serveWebhookOn(ctx, listener, "https://example.com/hook", "s3cret")
+	}()
+
+	// The webhook is registered before updates are handled.
+	waitFor(t, func() bool { return len(srv.Requests("setWebhook")) == 1 })
+
+	body, err := json.Marshal(privateMessage(testUserID, "/help"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+"/hook", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(webhookSecretHeader, "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	waitFor(t, func() bool { return len(srv.Requests("sendMessage")) == 1 })
+	reply := srv.Requests("sendMessage")[0].Params
+	if reply.Get("chat_id") != "42" || reply.Get("text") != botHelpText {
+		t.Errorf("reply = chat %s %q, want the help text in chat 42", reply.Get("chat_id"), reply.Get("text"))
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("serveWebhookOn: %v", err)
+	}
+}
+
+func TestServeWebhookRejectsPlainHTTP(t *testing.T) {
+	bot, srv := newTestBot(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.serveWebhookOn(context.Background(), listener, "http://example.com/hook", "s3cret"); err == nil {
+		t.Error("serveWebhookOn accepted an http URL")
+	}
+	if calls := srv.Requests("setWebhook"); len(calls) != 0 {
+		t.Errorf("got %d setWebhook calls, want none", len(calls))
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}